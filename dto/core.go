@@ -2,6 +2,7 @@ package dto
 
 import (
 	"io"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -10,6 +11,62 @@ type GetFileDTO struct {
 	Body          io.ReadCloser `json:"body"`
 	ContentType   *string       `json:"content_type"`
 	ContentLength *int64        `json:"content_length"`
+	ETag          *string       `json:"etag"`
+	LastModified  *time.Time    `json:"last_modified"`
+
+	// Range is the part of the object in Body, nil when the whole object is returned
+	Range *ByteRange `json:"range"`
+	// NotModified is set instead of Body when the client's cached copy is still current
+	NotModified bool `json:"not_modified"`
+
+	File *FileDTO `json:"file"`
+}
+
+// ByteRange is an inclusive range of bytes within an object
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+type ObjectInfoDTO struct {
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListedObjectDTO is an object found by listing a storage prefix
+type ListedObjectDTO struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ScanResultDTO is what a malware scanner found in some content
+type ScanResultDTO struct {
+	Infected bool `json:"infected"`
+	// Signature names the malware found, it is empty for clean content
+	Signature string `json:"signature"`
+}
+
+type StoredObjectDTO struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// Hash is the hex encoded SHA-256 of the object
+	Hash string `json:"hash"`
+	// MD5 is the hex encoded MD5 of the object
+	MD5 string `json:"md5"`
+	// WrappedKey is set when the object is encrypted, see model.Blob
+	WrappedKey []byte `json:"-"`
+}
+
+// ChecksumDTO holds the hex encoded digests a client sent along with an upload, empty ones aren't checked
+type ChecksumDTO struct {
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
 }
 
 type FileDTO struct {
@@ -22,10 +79,88 @@ type FileDTO struct {
 	MimeType     string     `json:"mime_type"`
 	Size         int64      `json:"size"`
 	Visibility   string     `json:"visibility"`
+	Hash         string     `json:"hash"`
+	MD5          string     `json:"md5"`
+	Version      int        `json:"version"`
+	// Metadata holds caller defined key-value pairs such as an order ID
+	Metadata map[string]string `json:"metadata"`
+	// ExpiresAt is when the file is deleted, nil keeps it until it is deleted by hand
+	ExpiresAt     *time.Time `json:"expires_at"`
+	ExpiryWarning bool       `json:"expiry_warning"`
+	// ScanStatus is pending until the content was scanned for malware, infected files are quarantined
+	ScanStatus    string `json:"scan_status,omitempty"`
+	ScanSignature string `json:"scan_signature,omitempty"`
+	// ProcessingStatus is pending until a direct upload was hashed and encrypted, it has no hash until then
+	ProcessingStatus string `json:"processing_status"`
 
 	Path string `json:"path"`
+	// Checksum is what the uploaded content must match, it is only set for uploads
+	Checksum *ChecksumDTO `json:"-"`
+	// UploadedBy is who uploads the file when that isn't its owner, such as an editor of a shared folder
+	UploadedBy *uuid.UUID `json:"-"`
+	// Highlight is the HTML-escaped name with the search terms wrapped in <mark> tags
+	Highlight string `json:"highlight,omitempty"`
 
 	Folder *FolderDTO `json:"folder"`
+	Tags   []TagDTO   `json:"tags"`
+}
+
+type FileVersionDTO struct {
+	DTO
+
+	FileID     uuid.UUID  `json:"file_id"`
+	Number     int        `json:"number"`
+	Size       int64      `json:"size"`
+	Hash       string     `json:"hash"`
+	MD5        string     `json:"md5"`
+	MimeType   string     `json:"mime_type"`
+	UploadedBy *uuid.UUID `json:"uploaded_by"`
+	Current    bool       `json:"current"`
+}
+
+// FileUpdateDTO renames and/or moves files. Move with a nil FolderID moves to the root folder.
+type FileUpdateDTO struct {
+	OriginalName *string    `json:"original_name"`
+	Move         bool       `json:"move"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	OnConflict   string     `json:"on_conflict"`
+}
+
+// FileAccessDTO describes who is asking for a file and any signed URL parameters they presented
+type FileAccessDTO struct {
+	RequesterID *uuid.UUID `json:"requester_id"`
+	Expires     int64      `json:"expires"`
+	Signature   string     `json:"signature"`
+	// Granted is set by callers that already checked access themselves, such as share links
+	Granted bool `json:"-"`
+	// Serving is called with the range about to be served, nil for all of it, before the content is
+	// opened. An error refuses the download.
+	Serving func(byteRange *ByteRange) error `json:"-"`
+}
+
+// FileConditionsDTO carries the range and conditional request headers of a download
+type FileConditionsDTO struct {
+	Range           string `json:"range"`
+	IfRange         string `json:"if_range"`
+	IfNoneMatch     string `json:"if_none_match"`
+	IfModifiedSince string `json:"if_modified_since"`
+	// Version selects an earlier version of the file, 0 serves the current one
+	Version int `json:"version"`
+	// Transform asks for an image file to be resized or converted, nil serves it unchanged
+	Transform *ImageTransformDTO `json:"transform"`
+}
+
+type ImageTransformDTO struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Fit     string `json:"fit"`
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+}
+
+type SignedURLDTO struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type UploadedFileDTO struct {
@@ -42,4 +177,178 @@ type FolderDTO struct {
 	Name     string     `json:"name"`
 
 	Parent *FolderDTO `json:"parent"`
+	Tags   []TagDTO   `json:"tags"`
+}
+
+type UploadSessionDTO struct {
+	DTO
+
+	UserID       uuid.UUID  `json:"user_id"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	OriginalName string     `json:"original_name"`
+	MimeType     string     `json:"mime_type"`
+	Visibility   string     `json:"visibility"`
+	Length       int64      `json:"length"`
+	Offset       int64      `json:"offset"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+
+	File *FileDTO `json:"file"`
+}
+
+type DirectUploadDTO struct {
+	DTO
+
+	UserID       uuid.UUID         `json:"user_id"`
+	FolderID     *uuid.UUID        `json:"folder_id"`
+	Key          string            `json:"key"`
+	OriginalName string            `json:"original_name"`
+	MimeType     string            `json:"mime_type"`
+	Visibility   string            `json:"visibility"`
+	Size         int64             `json:"size"`
+	URL          string            `json:"url"`
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+}
+
+type ContentTypeRuleDTO struct {
+	DTO
+
+	UserID     *uuid.UUID `json:"user_id,omitempty"`
+	Pattern    string     `json:"pattern"`
+	ScriptOnly bool       `json:"script_only"`
+}
+
+type StorageUsageDTO struct {
+	BytesUsed      int64 `json:"bytes_used"`
+	StorageQuota   int64 `json:"storage_quota"`
+	BytesRemaining int64 `json:"bytes_remaining"`
+	FileCount      int64 `json:"file_count"`
+}
+
+type TagDTO struct {
+	DTO
+
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Color  string    `json:"color"`
+}
+
+// TagItemsDTO attaches or detaches every tag in TagIDs to or from every listed file and folder
+type TagItemsDTO struct {
+	TagIDs    []uuid.UUID `json:"tag_ids"`
+	FileIDs   []uuid.UUID `json:"file_ids"`
+	FolderIDs []uuid.UUID `json:"folder_ids"`
+}
+
+// ReconcileReportDTO summarises a comparison of stored objects with the rows referring to them
+type ReconcileReportDTO struct {
+	DryRun         bool      `json:"dry_run"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	UsersScanned   int       `json:"users_scanned"`
+	ObjectsScanned int       `json:"objects_scanned"`
+	// OrphanedObjects counts objects nothing refers to, ObjectsDeleted those of them removed
+	OrphanedObjects int   `json:"orphaned_objects"`
+	OrphanedBytes   int64 `json:"orphaned_bytes"`
+	ObjectsDeleted  int   `json:"objects_deleted"`
+	// DanglingFiles counts files whose content is missing, FilesPurged those of them removed
+	DanglingFiles int `json:"dangling_files"`
+	FilesPurged   int `json:"files_purged"`
+	// Orphans and Dangling list the first of them, the counts cover all
+	Orphans  []ListedObjectDTO `json:"orphans"`
+	Dangling []DanglingFileDTO `json:"dangling"`
+	Errors   []string          `json:"errors"`
+}
+
+// DanglingFileDTO is a file whose current content is missing from storage
+type DanglingFileDTO struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"user_id"`
+	OriginalName string    `json:"original_name"`
+	Path         string    `json:"path"`
+	// Purged is set when the file was removed, files with an older version still stored are kept
+	Purged bool `json:"purged"`
+}
+
+// ShareLinkDTO is a link giving anyone holding its token access to a file or a folder
+type ShareLinkDTO struct {
+	DTO
+
+	Token        string     `json:"token"`
+	FileID       *uuid.UUID `json:"file_id"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	HasPassword  bool       `json:"has_password"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads *int64     `json:"max_downloads"`
+	Downloads    int64      `json:"downloads"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// CreateShareLinkDTO describes a new share link, it points at either FileID or FolderID
+type CreateShareLinkDTO struct {
+	FileID       *uuid.UUID
+	FolderID     *uuid.UUID
+	Password     string
+	ExpiresAt    *time.Time
+	MaxDownloads *int64
+}
+
+// SharedFileDTO is a file as visitors of a share link see it
+type SharedFileDTO struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SharedFolderDTO is a folder as visitors of a share link see it
+type SharedFolderDTO struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// SharedContentDTO is what a share link resolves to, either the shared file or the content of one
+// folder of the shared tree
+type SharedContentDTO struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	// DownloadsLeft is nil when the link has no download limit
+	DownloadsLeft *int64 `json:"downloads_left"`
+
+	File    *SharedFileDTO    `json:"file,omitempty"`
+	Folder  *SharedFolderDTO  `json:"folder,omitempty"`
+	Folders []SharedFolderDTO `json:"folders,omitempty"`
+	Files   []SharedFileDTO   `json:"files,omitempty"`
+}
+
+// PermissionDTO is a role another user has on a file, or on a folder and everything below it
+type PermissionDTO struct {
+	DTO
+
+	OwnerID  uuid.UUID  `json:"owner_id"`
+	UserID   uuid.UUID  `json:"user_id"`
+	Email    string     `json:"email"`
+	FileID   *uuid.UUID `json:"file_id"`
+	FolderID *uuid.UUID `json:"folder_id"`
+	Role     string     `json:"role"`
+}
+
+// GrantPermissionDTO gives the user with Email a role on either FileID or FolderID
+type GrantPermissionDTO struct {
+	Email    string
+	FileID   *uuid.UUID
+	FolderID *uuid.UUID
+	Role     string
+}
+
+// SharedItemDTO is a file or folder another user shared with the requester
+type SharedItemDTO struct {
+	PermissionID uuid.UUID  `json:"permission_id"`
+	Role         string     `json:"role"`
+	OwnerID      uuid.UUID  `json:"owner_id"`
+	OwnerEmail   string     `json:"owner_email"`
+	SharedAt     time.Time  `json:"shared_at"`
+	File         *FileDTO   `json:"file,omitempty"`
+	Folder       *FolderDTO `json:"folder,omitempty"`
 }
@@ -16,6 +16,20 @@ type SubscriptionPlan struct {
 	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	MaxUploadSize   int64 `json:"max_upload_size"`
+	MaxFileVersions int   `json:"max_file_versions"`
+	StorageQuota    int64 `json:"storage_quota"`
+	MaxArchiveSize  int64 `json:"max_archive_size"`
+}
+
+// PlanLimits are the effective limits for a user, resolved from their active plan or the free tier
+type PlanLimits struct {
+	PlanID          *uuid.UUID `json:"plan_id"`
+	MaxUploadSize   int64      `json:"max_upload_size"`
+	MaxFileVersions int        `json:"max_file_versions"`
+	StorageQuota    int64      `json:"storage_quota"`
+	MaxArchiveSize  int64      `json:"max_archive_size"`
 }
 
 type UserSubscription struct {
@@ -0,0 +1,168 @@
+package core_handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/payload/request"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+// ContentTypeHandlerInterface manages the globally blocked (admin) and per-user allowed upload types
+type ContentTypeHandlerInterface interface {
+	GetBlockedTypes(c *fiber.Ctx) error
+	BlockType(c *fiber.Ctx) error
+	UnblockType(c *fiber.Ctx) error
+	GetAllowedTypes(c *fiber.Ctx) error
+	AllowType(c *fiber.Ctx) error
+	RemoveAllowedType(c *fiber.Ctx) error
+}
+
+type contentTypeHandler struct {
+	contentTypeService core_service.ContentTypeServiceInterface
+}
+
+func NewContentTypeHandler(contentTypeService core_service.ContentTypeServiceInterface) ContentTypeHandlerInterface {
+	return &contentTypeHandler{contentTypeService: contentTypeService}
+}
+
+func (h *contentTypeHandler) GetBlockedTypes(c *fiber.Ctx) error {
+	var resp response.Response
+
+	rules, err := h.contentTypeService.FindBlockedTypes()
+	if err != nil {
+		return h.contentTypeError(c, err, "Failed to get blocked content types")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Blocked content types fetched successfully"
+	resp.Data = map[string]interface{}{"result": rules}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *contentTypeHandler) BlockType(c *fiber.Ctx) error {
+	var resp response.Response
+	var ruleReq request.ContentTypeRuleRequest
+
+	if err := c.BodyParser(&ruleReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	rule, err := h.contentTypeService.BlockType(ruleReq.Pattern, ruleReq.ScriptOnly)
+	if err != nil {
+		return h.contentTypeError(c, err, "Failed to block content type")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Content type blocked successfully"
+	resp.Data = map[string]interface{}{"result": rule}
+
+	return c.Status(http.StatusCreated).JSON(resp)
+}
+
+func (h *contentTypeHandler) UnblockType(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.contentTypeError(c, core_service.ErrContentTypeRuleNotFound, "")
+	}
+
+	if err := h.contentTypeService.UnblockType(id); err != nil {
+		return h.contentTypeError(c, err, "Failed to unblock content type")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Content type unblocked successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *contentTypeHandler) GetAllowedTypes(c *fiber.Ctx) error {
+	var resp response.Response
+
+	rules, err := h.contentTypeService.FindAllowedTypes(handler.GetUserId(c))
+	if err != nil {
+		return h.contentTypeError(c, err, "Failed to get allowed content types")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Allowed content types fetched successfully"
+	resp.Data = map[string]interface{}{"result": rules}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *contentTypeHandler) AllowType(c *fiber.Ctx) error {
+	var resp response.Response
+	var ruleReq request.ContentTypeRuleRequest
+
+	if err := c.BodyParser(&ruleReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	rule, err := h.contentTypeService.AllowType(handler.GetUserId(c), ruleReq.Pattern)
+	if err != nil {
+		return h.contentTypeError(c, err, "Failed to allow content type")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Content type allowed successfully"
+	resp.Data = map[string]interface{}{"result": rule}
+
+	return c.Status(http.StatusCreated).JSON(resp)
+}
+
+func (h *contentTypeHandler) RemoveAllowedType(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.contentTypeError(c, core_service.ErrContentTypeRuleNotFound, "")
+	}
+
+	if err := h.contentTypeService.RemoveAllowedType(id, handler.GetUserId(c)); err != nil {
+		return h.contentTypeError(c, err, "Failed to remove allowed content type")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Allowed content type removed successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *contentTypeHandler) contentTypeError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrContentTypeRuleNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrContentTypeRuleExists):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusConflict).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidContentTypePattern):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorDatabase
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
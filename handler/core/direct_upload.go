@@ -0,0 +1,140 @@
+package core_handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/payload/request"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+// DirectUploadHandlerInterface lets clients upload straight to storage through a presigned URL
+type DirectUploadHandlerInterface interface {
+	CreateDirectUpload(c *fiber.Ctx) error
+	FinalizeDirectUpload(c *fiber.Ctx) error
+}
+
+type directUploadHandler struct {
+	directUploadService core_service.DirectUploadServiceInterface
+}
+
+func NewDirectUploadHandler(directUploadService core_service.DirectUploadServiceInterface) DirectUploadHandlerInterface {
+	return &directUploadHandler{directUploadService: directUploadService}
+}
+
+func (h *directUploadHandler) CreateDirectUpload(c *fiber.Ctx) error {
+	var resp response.Response
+	var uploadDto dto.DirectUploadDTO
+	var createUploadReq request.CreateDirectUploadRequest
+
+	if err := c.BodyParser(&createUploadReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	if createUploadReq.FileName == "" || createUploadReq.Size < 0 {
+		resp.Status = constants.ClientRequestValidationError
+		resp.Message = "file_name is required and size can't be negative"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	uploadDto.UserID = handler.GetUserId(c)
+	uploadDto.FolderID = createUploadReq.FolderID
+	uploadDto.OriginalName = createUploadReq.FileName
+	uploadDto.MimeType = createUploadReq.ContentType
+	uploadDto.Visibility = createUploadReq.Visibility
+	uploadDto.Size = createUploadReq.Size
+
+	if uploadDto.MimeType == "" {
+		uploadDto.MimeType = "application/octet-stream"
+	}
+
+	upload, err := h.directUploadService.CreateDirectUpload(uploadDto)
+	if err != nil {
+		return h.directUploadError(c, err)
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Upload URL created successfully"
+	resp.Data = map[string]interface{}{"result": upload}
+
+	return c.Status(http.StatusCreated).JSON(resp)
+}
+
+func (h *directUploadHandler) FinalizeDirectUpload(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorResourceNotFound
+		resp.Message = core_service.ErrDirectUploadNotFound.Error()
+
+		return c.Status(http.StatusNotFound).JSON(resp)
+	}
+
+	uploadedFile, err := h.directUploadService.FinalizeDirectUpload(id, handler.GetUserId(c))
+	if err != nil {
+		return h.directUploadError(c, err)
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "file uploaded successfully"
+	resp.Data = map[string]interface{}{"result": uploadedFile}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *directUploadHandler) directUploadError(c *fiber.Ctx, err error) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrDirectUploadNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderAccessDenied):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, core_service.ErrDirectUploadIncomplete):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusConflict).JSON(resp)
+	case errors.Is(err, config.ErrPresignNotSupported):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusNotImplemented).JSON(resp)
+	case errors.Is(err, helper.ErrBodyTooLarge):
+		resp.Status = constants.ClientErrorPayloadTooLarge
+		resp.Message = "File exceeds the upload limit of your plan"
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidVisibility):
+		resp.Status = constants.ClientUnProcessableEntity
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	case errors.Is(err, core_service.ErrContentTypeBlocked),
+		errors.Is(err, core_service.ErrContentTypeNotAllowed),
+		errors.Is(err, core_service.ErrContentTypeMismatch):
+		resp.Status = constants.ClientErrorUnsupportedType
+		return c.Status(http.StatusUnsupportedMediaType).JSON(resp)
+	case errors.Is(err, core_service.ErrStorageQuotaExceeded):
+		resp.Status = constants.ClientErrorQuotaExceeded
+		return c.Status(http.StatusInsufficientStorage).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
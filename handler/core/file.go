@@ -1,25 +1,71 @@
 package core_handler
 
 import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
 	"github.com/shordem/api.thryvo/dto"
 	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/config"
 	"github.com/shordem/api.thryvo/lib/constants"
 	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/payload/request"
 	"github.com/shordem/api.thryvo/payload/response"
 	core_repository "github.com/shordem/api.thryvo/repository/core"
 	core_service "github.com/shordem/api.thryvo/service/core"
 )
 
+// Checksum headers of uploads and downloads, Content-MD5 is the base64 MD5 of the content (RFC 1864)
+// and X-Checksum-SHA256 its SHA-256
+const (
+	HeaderContentMD5     = "Content-MD5"
+	HeaderChecksumSHA256 = "X-Checksum-SHA256"
+)
+
+// metadataPrefix marks form fields and query parameters that carry a metadata key
+const metadataPrefix = "meta."
+
+// PublicFileMaxAge is how long shared caches may keep a public file
+var PublicFileMaxAge = 24 * time.Hour
+
 type FileHandlerInterface interface {
 	UploadFile(c *fiber.Ctx) error
+	UploadFiles(c *fiber.Ctx) error
+	DownloadFolder(c *fiber.Ctx) error
+	DownloadFiles(c *fiber.Ctx) error
 	GetUserFiles(c *fiber.Ctx) error
 	GetFile(c *fiber.Ctx) error
+	CreateSignedURL(c *fiber.Ctx) error
+	UpdateFile(c *fiber.Ctx) error
+	UpdateMetadata(c *fiber.Ctx) error
+	SetExpiry(c *fiber.Ctx) error
+	ReconcileStorage(c *fiber.Ctx) error
+	GetQuarantinedFiles(c *fiber.Ctx) error
+	MoveFiles(c *fiber.Ctx) error
+	DeleteFile(c *fiber.Ctx) error
+	GetTrashedFiles(c *fiber.Ctx) error
+	RestoreFile(c *fiber.Ctx) error
+	PurgeFile(c *fiber.Ctx) error
+	UploadVersion(c *fiber.Ctx) error
+	GetFileVersions(c *fiber.Ctx) error
+	RestoreVersion(c *fiber.Ctx) error
 }
 
 type fileHandler struct {
@@ -63,14 +109,213 @@ func (h *fileHandler) GeneratePageable(c *fiber.Ctx) (filePageable core_reposito
 	return filePageable
 }
 
+// fileFilters reads the search filters of GET /file. Lists are comma separated, dates are RFC 3339
+// timestamps or plain dates and sizes are in bytes.
+func (h *fileHandler) fileFilters(c *fiber.Ctx) (core_repository.FileFilters, error) {
+	var filters core_repository.FileFilters
+
+	for _, mimeType := range queryList(c, "type") {
+		filters.MimeTypes = append(filters.MimeTypes, strings.ToLower(mimeType))
+	}
+
+	if category := c.Query("category"); category != "" {
+		mimeTypes, ok := core_service.FileCategories[strings.ToLower(category)]
+		if !ok {
+			return filters, errors.New("category must be one of image, video, audio, document or archive")
+		}
+
+		if len(filters.MimeTypes) > 0 {
+			return filters, errors.New("type and category can't be combined")
+		}
+
+		filters.MimeTypes = mimeTypes
+	}
+
+	for _, ext := range queryList(c, "ext") {
+		filters.Extensions = append(filters.Extensions, strings.TrimPrefix(strings.ToLower(ext), "."))
+	}
+
+	var err error
+
+	if filters.MinSize, err = querySize(c, "min_size"); err != nil {
+		return filters, err
+	}
+
+	if filters.MaxSize, err = querySize(c, "max_size"); err != nil {
+		return filters, err
+	}
+
+	dates := map[string]**time.Time{
+		"created_after":  &filters.CreatedAfter,
+		"created_before": &filters.CreatedBefore,
+		"updated_after":  &filters.UpdatedAfter,
+		"updated_before": &filters.UpdatedBefore,
+	}
+
+	for name, target := range dates {
+		if *target, err = queryTime(c, name); err != nil {
+			return filters, err
+		}
+	}
+
+	if visibility := c.Query("visibility"); visibility != "" {
+		if filters.Visibility, err = core_service.ParseVisibility(visibility); err != nil {
+			return filters, err
+		}
+	}
+
+	for name, value := range c.Queries() {
+		if key, ok := strings.CutPrefix(name, metadataPrefix); ok {
+			if filters.Metadata == nil {
+				filters.Metadata = map[string]string{}
+			}
+
+			filters.Metadata[key] = value
+		}
+	}
+
+	switch filters.ScanStatus = strings.ToLower(c.Query("scan_status")); filters.ScanStatus {
+	case "", core_service.ScanStatusPending, core_service.ScanStatusClean, core_service.ScanStatusInfected, core_service.ScanStatusFailed:
+	default:
+		return filters, errors.New("scan_status must be pending, clean, infected or failed")
+	}
+
+	filters.Tags = queryList(c, "tags")
+
+	switch filters.TagMatch = strings.ToLower(c.Query("tag_match", core_repository.TagMatchAll)); filters.TagMatch {
+	case core_repository.TagMatchAll, core_repository.TagMatchAny:
+	default:
+		return filters, errors.New("tag_match must be all or any")
+	}
+
+	return filters, nil
+}
+
+func queryList(c *fiber.Ctx, name string) []string {
+	values := []string{}
+
+	for _, value := range strings.Split(c.Query(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func querySize(c *fiber.Ctx, name string) (*int64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("%s must be a number of bytes", name)
+	}
+
+	return &size, nil
+}
+
+func queryTime(c *fiber.Ctx, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s must be a date such as 2024-01-31 or 2024-01-31T15:04:05Z", name)
+}
+
+// formMetadata collects file metadata from the form fields, either a "metadata" field holding a JSON
+// object or one "meta.<key>" field per key, which take precedence
+func formMetadata(fields map[string]string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	if encoded := fields["metadata"]; encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &metadata); err != nil {
+			return nil, core_service.ErrInvalidMetadata
+		}
+	}
+
+	for name, value := range fields {
+		if key, ok := strings.CutPrefix(name, metadataPrefix); ok {
+			metadata[key] = value
+		}
+	}
+
+	return metadata, nil
+}
+
+// formExpiry reads when an upload expires from the "expires_at" or "ttl" field, and whether its owner
+// is warned before from "expiry_warning"
+func formExpiry(fields map[string]string) (*time.Time, bool, error) {
+	expiresAt, err := core_service.ParseExpiry(fields["expires_at"], fields["ttl"], time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	warning, _ := strconv.ParseBool(fields["expiry_warning"])
+
+	return expiresAt, warning && expiresAt != nil, nil
+}
+
+// uploadChecksum reads the digests a client sent for an upload. Content-MD5 is base64 encoded as in
+// RFC 1864, X-Checksum-SHA256 may be hex or base64 encoded. It returns nil when neither is sent.
+func uploadChecksum(c *fiber.Ctx) (*dto.ChecksumDTO, error) {
+	contentMD5 := strings.TrimSpace(c.Get(HeaderContentMD5))
+	sha256Sum := strings.TrimSpace(c.Get(HeaderChecksumSHA256))
+
+	if contentMD5 == "" && sha256Sum == "" {
+		return nil, nil
+	}
+
+	var checksum dto.ChecksumDTO
+
+	if contentMD5 != "" {
+		digest, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(digest) != md5.Size {
+			return nil, core_service.ErrInvalidChecksum
+		}
+
+		checksum.MD5 = hex.EncodeToString(digest)
+	}
+
+	if sha256Sum != "" {
+		digest, err := hex.DecodeString(sha256Sum)
+		if err != nil {
+			digest, err = base64.StdEncoding.DecodeString(sha256Sum)
+		}
+
+		if err != nil || len(digest) != sha256.Size {
+			return nil, core_service.ErrInvalidChecksum
+		}
+
+		checksum.SHA256 = hex.EncodeToString(digest)
+	}
+
+	return &checksum, nil
+}
+
+// UploadFile streams the "file" part of a multipart body straight to storage.
+// Form fields such as folder_id and visibility must be sent before the file part.
 func (h *fileHandler) UploadFile(c *fiber.Ctx) error {
 	var resp response.Response
 	var fileDto dto.FileDTO
 
-	userId := handler.GetUserId(c)
-	folderId := c.FormValue("folder_id")
-	file, err := c.FormFile("file")
+	checksum, err := uploadChecksum(c)
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	fileDto.Checksum = checksum
 
+	reader, err := handler.MultipartStream(c)
 	if err != nil {
 		resp.Status = constants.ClientUnProcessableEntity
 		resp.Message = "File is required"
@@ -78,47 +323,280 @@ func (h *fileHandler) UploadFile(c *fiber.Ctx) error {
 		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
 	}
 
-	fileDto.UserID = userId
-	if folderId != "" {
-		folderUUID, err := uuid.Parse(folderId)
+	fields := map[string]string{}
+
+	for {
+		part, err := h.nextFilePart(reader, fields)
 		if err != nil {
-			resp.Status = constants.ClientUnProcessableEntity
-			resp.Message = "Invalid folder ID"
+			return h.uploadError(c, err)
+		}
 
-			return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+		if part == nil {
+			break
+		}
+
+		fileDto.UserID = handler.GetUserId(c)
+		if folderId := fields["folder_id"]; folderId != "" {
+			folderUUID, err := uuid.Parse(folderId)
+			if err != nil {
+				resp.Status = constants.ClientUnProcessableEntity
+				resp.Message = "Invalid folder ID"
+
+				return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+			}
+			fileDto.FolderID = &folderUUID
+		}
+		fileDto.OriginalName = part.FileName()
+		fileDto.MimeType = part.Header.Get("Content-Type")
+		fileDto.Visibility = fields["visibility"]
+
+		if fileDto.Metadata, err = formMetadata(fields); err != nil {
+			return h.uploadError(c, err)
+		}
+
+		if fileDto.ExpiresAt, fileDto.ExpiryWarning, err = formExpiry(fields); err != nil {
+			return h.uploadError(c, err)
+		}
+
+		uploadedFile, err := h.fileService.UploadFile(fileDto, part)
+		if err != nil {
+			return h.uploadError(c, err)
 		}
-		fileDto.FolderID = &folderUUID
+
+		if err := handler.DiscardMultipart(reader); err != nil {
+			c.Context().SetConnectionClose()
+		}
+
+		resp.Status = constants.SuccessOperationCompleted
+		resp.Message = "file uploaded successfully"
+		resp.Data = map[string]interface{}{"result": uploadedFile}
+
+		return c.Status(http.StatusOK).JSON(resp)
 	}
-	fileDto.OriginalName = file.Filename
-	fileDto.MimeType = file.Header.Get("Content-Type")
-	fileDto.Size = file.Size
-	fileDto.Visibility = core_service.FileVisibilityPublic
 
-	uploadedFile, err := h.fileService.UploadFile(fileDto, file)
+	resp.Status = constants.ClientUnProcessableEntity
+	resp.Message = "File is required"
+
+	return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+}
+
+// UploadFiles streams every "file" part of a multipart body to storage, storing several files at once,
+// and reports the outcome of each. Form fields apply to the file parts that follow them.
+func (h *fileHandler) UploadFiles(c *fiber.Ctx) error {
+	var resp response.Response
+
+	userId := handler.GetUserId(c)
+
+	reader, err := handler.MultipartStream(c)
 	if err != nil {
-		resp.Status = constants.ServerErrorExternalService
-		resp.Message = err.Error()
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Files are required"
 
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	batch, err := h.fileService.NewBatchUpload(userId)
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	var readErr error
+	fields := map[string]string{}
+
+	for {
+		part, err := h.nextFilePart(reader, fields)
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		if part == nil {
+			break
+		}
+
+		fileDto := dto.FileDTO{
+			UserID:       userId,
+			OriginalName: part.FileName(),
+			MimeType:     part.Header.Get("Content-Type"),
+			Visibility:   fields["visibility"],
+		}
+
+		if folderId := fields["folder_id"]; folderId != "" {
+			folderUUID, err := uuid.Parse(folderId)
+			if err != nil {
+				readErr = core_service.ErrFolderNotFound
+				break
+			}
+
+			fileDto.FolderID = &folderUUID
+		}
+
+		if fileDto.Metadata, err = formMetadata(fields); err != nil {
+			readErr = err
+			break
+		}
+
+		if fileDto.ExpiresAt, fileDto.ExpiryWarning, err = formExpiry(fields); err != nil {
+			readErr = err
+			break
+		}
+
+		if err := batch.Add(fileDto, part); err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	results := []response.BatchUploadResult{}
+	failed := 0
+
+	for index, result := range batch.Wait() {
+		item := response.BatchUploadResult{Index: index, FileName: result.FileName, Success: result.Err == nil, Status: http.StatusCreated}
+
+		if result.Err != nil {
+			failed++
+			item.Status, _ = h.uploadErrorResponse(result.Err)
+			item.Error = result.Err.Error()
+		} else {
+			item.File = result.File
+		}
+
+		results = append(results, item)
+	}
+
+	// files stored before the body broke off are still reported
+	if readErr != nil {
+		status, resp := h.uploadErrorResponse(readErr)
+		resp.Data = map[string]interface{}{"result": results}
+
+		c.Context().SetConnectionClose()
+
+		return c.Status(status).JSON(resp)
+	}
+
+	if len(results) == 0 {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Files are required"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Data = map[string]interface{}{"result": results}
+	resp.Meta = map[string]interface{}{"total": len(results), "succeeded": len(results) - failed, "failed": failed}
+
+	if failed > 0 {
+		resp.Status = constants.SuccessOperationCompleted
+		resp.Message = "Some files failed to upload"
+
+		return c.Status(http.StatusMultiStatus).JSON(resp)
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
-	resp.Message = "file uploaded successfully"
-	resp.Data = map[string]interface{}{"result": uploadedFile}
+	resp.Message = "Files uploaded successfully"
 
 	return c.Status(http.StatusOK).JSON(resp)
 }
 
+// nextFilePart collects the form fields in front of the next "file" part into fields and returns that part,
+// or nil once the body is exhausted
+func (h *fileHandler) nextFilePart(reader *multipart.Reader, fields map[string]string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// batch uploads usually repeat a "files" field
+		if name := part.FormName(); (name == "file" || name == "files" || name == "files[]") && part.FileName() != "" {
+			return part, nil
+		}
+
+		value, err := handler.ReadFormValue(part)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[part.FormName()] = value
+	}
+}
+
+func (h *fileHandler) uploadError(c *fiber.Ctx, err error) error {
+	// the rest of the body is left unread, so the connection can't be reused
+	c.Context().SetConnectionClose()
+
+	status, resp := h.uploadErrorResponse(err)
+
+	return c.Status(status).JSON(resp)
+}
+
+// uploadErrorResponse maps an upload failure to its HTTP status and response body
+func (h *fileHandler) uploadErrorResponse(err error) (int, response.Response) {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, helper.ErrBodyTooLarge):
+		resp.Status = constants.ClientErrorPayloadTooLarge
+		resp.Message = "File exceeds the upload limit of your plan"
+		return http.StatusRequestEntityTooLarge, resp
+	case errors.Is(err, core_service.ErrInvalidChecksum):
+		resp.Status = constants.ClientErrorBadRequest
+		return http.StatusBadRequest, resp
+	case errors.Is(err, core_service.ErrChecksumMismatch):
+		resp.Status = constants.ClientRequestValidationError
+		return http.StatusUnprocessableEntity, resp
+	case errors.Is(err, core_service.ErrInvalidVisibility),
+		errors.Is(err, core_service.ErrInvalidMetadata),
+		errors.Is(err, core_service.ErrInvalidExpiry):
+		resp.Status = constants.ClientUnProcessableEntity
+		return http.StatusUnprocessableEntity, resp
+	case errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return http.StatusNotFound, resp
+	case errors.Is(err, core_service.ErrFolderAccessDenied):
+		resp.Status = constants.ClientErrorForbidden
+		return http.StatusForbidden, resp
+	case errors.Is(err, core_service.ErrContentTypeBlocked),
+		errors.Is(err, core_service.ErrContentTypeNotAllowed),
+		errors.Is(err, core_service.ErrContentTypeMismatch):
+		resp.Status = constants.ClientErrorUnsupportedType
+		return http.StatusUnsupportedMediaType, resp
+	case errors.Is(err, core_service.ErrStorageQuotaExceeded):
+		resp.Status = constants.ClientErrorQuotaExceeded
+		return http.StatusInsufficientStorage, resp
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+
+	return http.StatusInternalServerError, resp
+}
+
 func (h *fileHandler) GetUserFiles(c *fiber.Ctx) error {
 	var resp response.Response
 	pageable := h.GeneratePageable(c)
 
-	files, pagination, err := h.fileService.FindAllFiles(pageable)
+	filters, err := h.fileFilters(c)
 	if err != nil {
-		resp.Status = constants.ServerErrorExternalService
-		resp.Message = "Failed to get user files"
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = err.Error()
 
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	pageable.Filters = filters
+
+	if pageable.Search != "" && c.Query("sort_by") == "" {
+		pageable.SortBy = core_repository.FileSortRelevance
+	}
+
+	files, pagination, err := h.fileService.FindAllFiles(pageable)
+	if err != nil {
+		return h.fileError(c, err, "Failed to get user files")
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
@@ -129,23 +607,663 @@ func (h *fileHandler) GetUserFiles(c *fiber.Ctx) error {
 }
 
 func (h *fileHandler) GetFile(c *fiber.Ctx) error {
-	var resp response.Response
+	var access dto.FileAccessDTO
 	userId := c.Params("user_id")
 	mediaId := c.Params("key")
 
-	media, err := h.fileService.GetFile(userId, mediaId)
+	access.RequesterID = handler.GetOptionalUserId(c)
+	access.Expires, _ = strconv.ParseInt(c.Query("expires"), 10, 64)
+	access.Signature = c.Query("signature")
+
+	conditions := dto.FileConditionsDTO{
+		Range:           c.Get(fiber.HeaderRange),
+		IfRange:         c.Get(fiber.HeaderIfRange),
+		IfNoneMatch:     c.Get(fiber.HeaderIfNoneMatch),
+		IfModifiedSince: c.Get(fiber.HeaderIfModifiedSince),
+	}
+
+	if version := c.Query("version"); version != "" {
+		number, err := strconv.Atoi(version)
+		if err != nil || number < 1 {
+			return h.fileError(c, core_service.ErrVersionNotFound, "")
+		}
+
+		conditions.Version = number
+	}
+
+	transform, err := imageTransform(c)
 	if err != nil {
-		resp.Status = constants.ServerErrorExternalService
-		resp.Message = "Failed to get media"
-		c.Status(http.StatusInternalServerError).JSON(resp)
-		return err
+		return h.fileError(c, err, "")
 	}
 
-	// stream media
-	c.Set("Content-Type", *media.ContentType)
-	c.Set("Content-Disposition", "inline")
-	c.Set("Content-Length", helper.Int64ToString(*media.ContentLength))
-	c.SendStream(media.Body)
+	conditions.Transform = transform
 
-	return nil
+	media, err := h.fileService.GetFile(userId, mediaId, access, conditions)
+	if err != nil {
+		if errors.Is(err, helper.ErrRangeNotSatisfiable) && media.File != nil {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", media.File.Size))
+
+			return c.SendStatus(http.StatusRequestedRangeNotSatisfiable)
+		}
+
+		return h.fileError(c, err, "Failed to get media")
+	}
+
+	return sendMedia(c, media, transform != nil, media.File.Visibility == core_service.FileVisibilityPublic)
+}
+
+// sendMedia writes a file fetched for download along with its validators, digests and range headers.
+// Only public responses may be kept by shared caches.
+func sendMedia(c *fiber.Ctx, media dto.GetFileDTO, transformed bool, public bool) error {
+	c.Set(fiber.HeaderETag, *media.ETag)
+	c.Set(fiber.HeaderLastModified, media.LastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	if public {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(PublicFileMaxAge.Seconds())))
+	} else {
+		// private responses must not be shared by caches and are revalidated on every use
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	}
+
+	if media.NotModified {
+		return c.SendStatus(http.StatusNotModified)
+	}
+
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		disposition = "attachment"
+	}
+
+	// markup could run script on our origin when rendered, so it is never shown inline
+	if helper.IsMarkup(media.File.MimeType) {
+		disposition = "attachment"
+		c.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": media.File.OriginalName}))
+	// the stored type was checked against the content, the object's own metadata may be what the client claimed
+	c.Set(fiber.HeaderContentType, media.File.MimeType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+
+	// digests describe the stored content, so only whole, untransformed responses carry them
+	if media.Range == nil && !transformed {
+		if media.File.Hash != "" {
+			c.Set(HeaderChecksumSHA256, media.File.Hash)
+		}
+
+		if digest, err := hex.DecodeString(media.File.MD5); err == nil && len(digest) == md5.Size {
+			c.Set(HeaderContentMD5, base64.StdEncoding.EncodeToString(digest))
+		}
+	}
+
+	if media.Range != nil {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", media.Range.Start, media.Range.End, media.File.Size))
+		c.Status(http.StatusPartialContent)
+	}
+
+	return c.SendStream(media.Body, int(*media.ContentLength))
+}
+
+// DownloadFolder streams a ZIP archive of a folder and everything below it
+func (h *fileHandler) DownloadFolder(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid folder ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	archive, err := h.fileService.ArchiveFolder(handler.GetUserId(c), id)
+	if err != nil {
+		return h.fileError(c, err, "Failed to download folder")
+	}
+
+	return h.sendArchive(c, archive)
+}
+
+// DownloadFiles streams a ZIP archive of the selected files
+func (h *fileHandler) DownloadFiles(c *fiber.Ctx) error {
+	var resp response.Response
+	var archiveFilesReq request.ArchiveFilesRequest
+
+	if err := c.BodyParser(&archiveFilesReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	archive, err := h.fileService.ArchiveFiles(handler.GetUserId(c), archiveFilesReq.FileIDs)
+	if err != nil {
+		return h.fileError(c, err, "Failed to download files")
+	}
+
+	return h.sendArchive(c, archive)
+}
+
+// sendArchive writes the archive straight into the response as it is read from storage. The status is
+// sent before the first entry, so a storage failure can only cut the archive short.
+func (h *fileHandler) sendArchive(c *fiber.Ctx, archive core_service.ArchiveInterface) error {
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": archive.Name()}))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := archive.Write(w); err != nil {
+			log.Printf("archive %s: %s", archive.Name(), err)
+		}
+	})
+
+	return nil
+}
+
+func (h *fileHandler) CreateSignedURL(c *fiber.Ctx) error {
+	var resp response.Response
+	var signedURLReq request.CreateSignedURLRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&signedURLReq); err != nil {
+			resp.Status = constants.ClientUnProcessableEntity
+			resp.Message = "Invalid request"
+
+			return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+		}
+	}
+
+	signedURL, err := h.fileService.CreateSignedURL(id, handler.GetUserId(c), time.Duration(signedURLReq.ExpiresIn)*time.Second)
+	if err != nil {
+		return h.fileError(c, err, "Failed to create signed URL")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Signed URL created successfully"
+	resp.Data = map[string]interface{}{"result": signedURL}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) UpdateFile(c *fiber.Ctx) error {
+	var resp response.Response
+	var updateFileReq request.UpdateFileRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if err := c.BodyParser(&updateFileReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	update := dto.FileUpdateDTO{
+		OriginalName: updateFileReq.OriginalName,
+		Move:         updateFileReq.MoveToRoot || updateFileReq.FolderID != nil,
+		OnConflict:   updateFileReq.OnConflict,
+	}
+
+	if !updateFileReq.MoveToRoot {
+		update.FolderID = updateFileReq.FolderID
+	}
+
+	file, err := h.fileService.UpdateFile(id, handler.GetUserId(c), update)
+	if err != nil {
+		return h.fileError(c, err, "Failed to update file")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File updated successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// UpdateMetadata merges the request's metadata into the file's, keys set to null are removed
+func (h *fileHandler) UpdateMetadata(c *fiber.Ctx) error {
+	var resp response.Response
+	var updateMetadataReq request.UpdateMetadataRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if err := c.BodyParser(&updateMetadataReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	file, err := h.fileService.UpdateMetadata(id, handler.GetUserId(c), updateMetadataReq.Metadata)
+	if err != nil {
+		return h.fileError(c, err, "Failed to update file metadata")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File metadata updated successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// SetExpiry sets when a file expires from expires_at or ttl, a request with neither keeps the file
+// until it is deleted by hand
+func (h *fileHandler) SetExpiry(c *fiber.Ctx) error {
+	var resp response.Response
+	var setExpiryReq request.SetExpiryRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if err := c.BodyParser(&setExpiryReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	expiresAt, err := core_service.ParseExpiry(setExpiryReq.ExpiresAt, expiryTTL(setExpiryReq.TTL), time.Now())
+	if err != nil {
+		return h.fileError(c, err, "")
+	}
+
+	file, err := h.fileService.SetExpiry(id, handler.GetUserId(c), expiresAt, setExpiryReq.ExpiryWarning)
+	if err != nil {
+		return h.fileError(c, err, "Failed to update file expiry")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File expiry updated successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) MoveFiles(c *fiber.Ctx) error {
+	var resp response.Response
+	var moveFilesReq request.MoveFilesRequest
+
+	if err := c.BodyParser(&moveFilesReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	files, err := h.fileService.MoveFiles(handler.GetUserId(c), moveFilesReq.FileIDs, dto.FileUpdateDTO{
+		FolderID:   moveFilesReq.FolderID,
+		OnConflict: moveFilesReq.OnConflict,
+	})
+	if err != nil {
+		return h.fileError(c, err, "Failed to move files")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Files moved successfully"
+	resp.Data = map[string]interface{}{"result": files}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) DeleteFile(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if err := h.fileService.DeleteFile(id, handler.GetUserId(c)); err != nil {
+		return h.fileError(c, err, "Failed to delete file")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File moved to trash"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) GetTrashedFiles(c *fiber.Ctx) error {
+	var resp response.Response
+
+	pageable := h.GeneratePageable(c)
+	pageable.Trashed = true
+
+	files, pagination, err := h.fileService.FindAllFiles(pageable)
+	if err != nil {
+		resp.Status = constants.ServerErrorExternalService
+		resp.Message = "Failed to get trashed files"
+
+		return c.Status(http.StatusInternalServerError).JSON(resp)
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Trashed files fetched successfully"
+	resp.Data = map[string]interface{}{"pagination": pagination, "result": files}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) RestoreFile(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	file, err := h.fileService.RestoreFile(id, handler.GetUserId(c))
+	if err != nil {
+		return h.fileError(c, err, "Failed to restore file")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File restored successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) PurgeFile(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	if err := h.fileService.PurgeFile(id, handler.GetUserId(c)); err != nil {
+		return h.fileError(c, err, "Failed to delete file")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File deleted permanently"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// ReconcileStorage compares stored objects with the file rows and reports the differences. Nothing is
+// changed unless dry_run=false is passed.
+func (h *fileHandler) ReconcileStorage(c *fiber.Ctx) error {
+	var resp response.Response
+
+	dryRun := true
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			resp.Status = constants.ClientErrorBadRequest
+			resp.Message = "dry_run must be true or false"
+
+			return c.Status(http.StatusBadRequest).JSON(resp)
+		}
+
+		dryRun = parsed
+	}
+
+	report, err := h.fileService.ReconcileStorage(c.UserContext(), dryRun)
+	if err != nil {
+		return h.fileError(c, err, "Failed to reconcile storage")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Storage reconciled successfully"
+	resp.Data = map[string]interface{}{"result": report}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// GetQuarantinedFiles lists the files of every user whose content was found to contain malware
+func (h *fileHandler) GetQuarantinedFiles(c *fiber.Ctx) error {
+	var resp response.Response
+
+	pageable := core_repository.FilePageable{Pageable: handler.GeneratePageable(c), HasFolder: true}
+	pageable.Filters.ScanStatus = core_service.ScanStatusInfected
+
+	files, pagination, err := h.fileService.FindAllFiles(pageable)
+	if err != nil {
+		resp.Status = constants.ServerErrorExternalService
+		resp.Message = "Failed to get quarantined files"
+
+		return c.Status(http.StatusInternalServerError).JSON(resp)
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Quarantined files fetched successfully"
+	resp.Data = map[string]interface{}{"pagination": pagination, "result": files}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// expiryTTL reads a ttl sent either as a number of seconds or as a string
+func expiryTTL(raw json.RawMessage) string {
+	ttl := string(raw)
+	if unquoted, err := strconv.Unquote(ttl); err == nil {
+		ttl = unquoted
+	}
+
+	if ttl == "null" {
+		return ""
+	}
+
+	return ttl
+}
+
+// imageTransform reads the image transformation query parameters, nil when none were given
+func imageTransform(c *fiber.Ctx) (*dto.ImageTransformDTO, error) {
+	width, height, fit, format, quality := c.Query("width"), c.Query("height"), c.Query("fit"), c.Query("format"), c.Query("quality")
+	if width == "" && height == "" && fit == "" && format == "" && quality == "" {
+		return nil, nil
+	}
+
+	transform := dto.ImageTransformDTO{Fit: fit, Format: format}
+
+	for _, param := range []struct {
+		value  string
+		target *int
+	}{{width, &transform.Width}, {height, &transform.Height}, {quality, &transform.Quality}} {
+		if param.value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(param.value)
+		if err != nil || n < 1 {
+			return nil, core_service.ErrInvalidTransform
+		}
+
+		*param.target = n
+	}
+
+	return &transform, nil
+}
+
+// UploadVersion streams the "file" part of a multipart body in as the new current version of a file
+func (h *fileHandler) UploadVersion(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	reader, err := handler.MultipartStream(c)
+	if err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "File is required"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	part, err := h.nextFilePart(reader, map[string]string{})
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	if part == nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "File is required"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	file, err := h.fileService.UploadVersion(id, handler.GetUserId(c), part.Header.Get("Content-Type"), part)
+	if err != nil {
+		if errors.Is(err, core_service.ErrFileNotFound) ||
+			errors.Is(err, core_service.ErrFileAccessDenied) ||
+			errors.Is(err, core_service.ErrFileProcessing) {
+			c.Context().SetConnectionClose()
+			return h.fileError(c, err, "")
+		}
+
+		return h.uploadError(c, err)
+	}
+
+	if err := handler.DiscardMultipart(reader); err != nil {
+		c.Context().SetConnectionClose()
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File version uploaded successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) GetFileVersions(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	versions, err := h.fileService.FindVersions(id, handler.GetUserId(c))
+	if err != nil {
+		return h.fileError(c, err, "Failed to get file versions")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File versions fetched successfully"
+	resp.Data = map[string]interface{}{"result": versions}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *fileHandler) RestoreVersion(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid file ID"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	number, err := strconv.Atoi(c.Params("version"))
+	if err != nil || number < 1 {
+		return h.fileError(c, core_service.ErrVersionNotFound, "")
+	}
+
+	file, err := h.fileService.RestoreVersion(id, handler.GetUserId(c), number)
+	if err != nil {
+		return h.fileError(c, err, "Failed to restore file version")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "File version restored successfully"
+	resp.Data = map[string]interface{}{"result": file}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// fileError maps file service errors to a response, anything unexpected is reported with fallback
+func (h *fileHandler) fileError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrFileNotFound), errors.Is(err, config.ErrObjectNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		resp.Message = core_service.ErrFileNotFound.Error()
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderNotFound), errors.Is(err, core_service.ErrVersionNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFileExpired):
+		resp.Status = constants.ClientErrorGone
+		return c.Status(http.StatusGone).JSON(resp)
+	case errors.Is(err, core_service.ErrFileNameConflict), errors.Is(err, core_service.ErrFileProcessing):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusConflict).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidFileName),
+		errors.Is(err, core_service.ErrInvalidConflict),
+		errors.Is(err, core_service.ErrNoFilesSelected),
+		errors.Is(err, core_service.ErrTooManyFiles),
+		errors.Is(err, core_service.ErrMixedOwners),
+		errors.Is(err, core_service.ErrInvalidMetadata),
+		errors.Is(err, core_service.ErrInvalidExpiry),
+		errors.Is(err, core_service.ErrTooManyArchiveFiles),
+		errors.Is(err, core_service.ErrArchiveTooLarge),
+		errors.Is(err, core_service.ErrNotAnImage),
+		errors.Is(err, core_service.ErrInvalidTransform),
+		errors.Is(err, helper.ErrUnsupportedImage),
+		errors.Is(err, helper.ErrImageTooLarge):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	case errors.Is(err, core_service.ErrFileAccessDenied),
+		errors.Is(err, core_service.ErrFolderAccessDenied),
+		errors.Is(err, core_service.ErrFileQuarantined):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, helper.ErrSigningNotConfigured):
+		resp.Status = constants.ServerErrorInternal
+		return c.Status(http.StatusNotImplemented).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
 }
@@ -1,6 +1,7 @@
 package core_handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -49,10 +50,7 @@ func (h *folderHandler) CreateFolder(c *fiber.Ctx) error {
 
 	_, err := h.folderService.CreateFolder(folderDto)
 	if err != nil {
-		resp.Status = constants.ServerErrorInternal
-		resp.Message = err.Error()
-
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return h.folderError(c, err, err.Error())
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
@@ -95,10 +93,7 @@ func (h *folderHandler) GetFoldersByParent(c *fiber.Ctx) error {
 
 	folders, err := h.folderService.FindFoldersByParentId(userId, parentId)
 	if err != nil {
-		resp.Status = constants.ServerErrorInternal
-		resp.Message = "Failed to fetch folders"
-
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return h.folderError(c, err, "Failed to fetch folders")
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
@@ -136,10 +131,7 @@ func (h *folderHandler) UpdateFolder(c *fiber.Ctx) error {
 	folderDto.ParentID = updateFolderReq.ParentID
 
 	if _, err = h.folderService.UpdateFolder(folderDto); err != nil {
-		resp.Status = constants.ServerErrorInternal
-		resp.Message = "Failed to update folder"
-
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return h.folderError(c, err, "Failed to update folder")
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
@@ -162,10 +154,7 @@ func (h *folderHandler) DeleteFolder(c *fiber.Ctx) error {
 	userId := handler.GetUserId(c)
 
 	if err = h.folderService.DeleteFolder(folderId, userId); err != nil {
-		resp.Status = constants.ServerErrorInternal
-		resp.Message = "Failed to delete folder"
-
-		return c.Status(http.StatusInternalServerError).JSON(resp)
+		return h.folderError(c, err, "Failed to delete folder")
 	}
 
 	resp.Status = constants.SuccessOperationCompleted
@@ -173,3 +162,26 @@ func (h *folderHandler) DeleteFolder(c *fiber.Ctx) error {
 
 	return c.JSON(resp)
 }
+
+func (h *folderHandler) folderError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderAccessDenied):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidFolderParent):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorInternal
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
@@ -0,0 +1,178 @@
+package core_handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/payload/request"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+type PermissionHandlerInterface interface {
+	GrantPermission(c *fiber.Ctx) error
+	GetPermissions(c *fiber.Ctx) error
+	UpdatePermission(c *fiber.Ctx) error
+	RevokePermission(c *fiber.Ctx) error
+	GetSharedWithMe(c *fiber.Ctx) error
+}
+
+type permissionHandler struct {
+	permissionService core_service.PermissionServiceInterface
+}
+
+func NewPermissionHandler(permissionService core_service.PermissionServiceInterface) PermissionHandlerInterface {
+	return &permissionHandler{permissionService: permissionService}
+}
+
+// GrantPermission shares a file or folder with another user by their email address
+func (h *permissionHandler) GrantPermission(c *fiber.Ctx) error {
+	var resp response.Response
+	var grantPermissionReq request.GrantPermissionRequest
+
+	if err := c.BodyParser(&grantPermissionReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	permission, err := h.permissionService.GrantPermission(handler.GetUserId(c), dto.GrantPermissionDTO{
+		Email:    grantPermissionReq.Email,
+		FileID:   grantPermissionReq.FileID,
+		FolderID: grantPermissionReq.FolderID,
+		Role:     grantPermissionReq.Role,
+	})
+	if err != nil {
+		return h.permissionError(c, err, "Failed to share item")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Item shared successfully"
+	resp.Data = map[string]interface{}{"result": permission}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// GetPermissions lists who the file_id or folder_id is shared with
+func (h *permissionHandler) GetPermissions(c *fiber.Ctx) error {
+	var resp response.Response
+
+	fileId, err := optionalUUID(c.Query("file_id"))
+	if err != nil {
+		return h.permissionError(c, core_service.ErrFileNotFound, "")
+	}
+
+	folderId, err := optionalUUID(c.Query("folder_id"))
+	if err != nil {
+		return h.permissionError(c, core_service.ErrFolderNotFound, "")
+	}
+
+	permissions, err := h.permissionService.FindPermissions(handler.GetUserId(c), fileId, folderId)
+	if err != nil {
+		return h.permissionError(c, err, "Failed to get permissions")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Permissions fetched successfully"
+	resp.Data = map[string]interface{}{"result": permissions}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *permissionHandler) UpdatePermission(c *fiber.Ctx) error {
+	var resp response.Response
+	var updatePermissionReq request.UpdatePermissionRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.permissionError(c, core_service.ErrPermissionNotFound, "")
+	}
+
+	if err := c.BodyParser(&updatePermissionReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	permission, err := h.permissionService.UpdatePermission(id, handler.GetUserId(c), updatePermissionReq.Role)
+	if err != nil {
+		return h.permissionError(c, err, "Failed to update permission")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Permission updated successfully"
+	resp.Data = map[string]interface{}{"result": permission}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// RevokePermission takes access away from a user, users can also remove themselves
+func (h *permissionHandler) RevokePermission(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.permissionError(c, core_service.ErrPermissionNotFound, "")
+	}
+
+	if err := h.permissionService.RevokePermission(id, handler.GetUserId(c)); err != nil {
+		return h.permissionError(c, err, "Failed to revoke permission")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Permission revoked successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *permissionHandler) GetSharedWithMe(c *fiber.Ctx) error {
+	var resp response.Response
+
+	items, err := h.permissionService.FindSharedWithMe(handler.GetUserId(c))
+	if err != nil {
+		return h.permissionError(c, err, "Failed to get shared items")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Shared items fetched successfully"
+	resp.Data = map[string]interface{}{"result": items}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *permissionHandler) permissionError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrPermissionNotFound),
+		errors.Is(err, core_service.ErrFileNotFound),
+		errors.Is(err, core_service.ErrFolderNotFound),
+		errors.Is(err, core_service.ErrShareUserNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFileAccessDenied),
+		errors.Is(err, core_service.ErrFolderAccessDenied):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidPermissionRole),
+		errors.Is(err, core_service.ErrInvalidPermissionTarget),
+		errors.Is(err, core_service.ErrInvalidShareUser):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
@@ -0,0 +1,224 @@
+package core_handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/payload/request"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+// HeaderSharePassword carries the password of a protected share link, it is kept out of URLs and logs
+const HeaderSharePassword = "X-Share-Password"
+
+type ShareHandlerInterface interface {
+	CreateShareLink(c *fiber.Ctx) error
+	GetShareLinks(c *fiber.Ctx) error
+	RevokeShareLink(c *fiber.Ctx) error
+	ResolveShareLink(c *fiber.Ctx) error
+	GetSharedFile(c *fiber.Ctx) error
+}
+
+type shareHandler struct {
+	shareService core_service.ShareServiceInterface
+}
+
+func NewShareHandler(shareService core_service.ShareServiceInterface) ShareHandlerInterface {
+	return &shareHandler{shareService: shareService}
+}
+
+func (h *shareHandler) CreateShareLink(c *fiber.Ctx) error {
+	var resp response.Response
+	var createShareLinkReq request.CreateShareLinkRequest
+
+	if err := c.BodyParser(&createShareLinkReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	expiresAt, err := core_service.ParseExpiry(createShareLinkReq.ExpiresAt, expiryTTL(createShareLinkReq.TTL), time.Now())
+	if err != nil {
+		return h.shareError(c, err, "")
+	}
+
+	link, err := h.shareService.CreateShareLink(handler.GetUserId(c), dto.CreateShareLinkDTO{
+		FileID:       createShareLinkReq.FileID,
+		FolderID:     createShareLinkReq.FolderID,
+		Password:     createShareLinkReq.Password,
+		ExpiresAt:    expiresAt,
+		MaxDownloads: createShareLinkReq.MaxDownloads,
+	})
+	if err != nil {
+		return h.shareError(c, err, "Failed to create share link")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Share link created successfully"
+	resp.Data = map[string]interface{}{"result": link}
+
+	return c.Status(http.StatusCreated).JSON(resp)
+}
+
+func (h *shareHandler) GetShareLinks(c *fiber.Ctx) error {
+	var resp response.Response
+
+	links, err := h.shareService.FindShareLinks(handler.GetUserId(c))
+	if err != nil {
+		return h.shareError(c, err, "Failed to get share links")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Share links fetched successfully"
+	resp.Data = map[string]interface{}{"result": links}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *shareHandler) RevokeShareLink(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.shareError(c, core_service.ErrShareNotFound, "")
+	}
+
+	if err := h.shareService.RevokeShareLink(id, handler.GetUserId(c)); err != nil {
+		return h.shareError(c, err, "Failed to revoke share link")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Share link revoked successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// ResolveShareLink shows what a link shares without signing in. For folders it lists the content of the
+// shared folder, or of the folder_id below it, with the files paginated.
+func (h *shareHandler) ResolveShareLink(c *fiber.Ctx) error {
+	var resp response.Response
+
+	folderId, err := optionalUUID(c.Query("folder_id"))
+	if err != nil {
+		return h.shareError(c, core_service.ErrFolderNotFound, "")
+	}
+
+	content, pagination, err := h.shareService.ResolveShareLink(c.Params("token"), c.Get(HeaderSharePassword), folderId, handler.GeneratePageable(c))
+	if err != nil {
+		return h.shareError(c, err, "Failed to open share link")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Share link opened successfully"
+	resp.Data = map[string]interface{}{"pagination": pagination, "result": content}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// GetSharedFile streams the shared file, or the file_id inside a shared folder
+func (h *shareHandler) GetSharedFile(c *fiber.Ctx) error {
+	fileId, err := optionalUUID(c.Query("file_id"))
+	if err != nil {
+		return h.shareError(c, core_service.ErrFileNotFound, "")
+	}
+
+	conditions := dto.FileConditionsDTO{
+		Range:           c.Get(fiber.HeaderRange),
+		IfRange:         c.Get(fiber.HeaderIfRange),
+		IfNoneMatch:     c.Get(fiber.HeaderIfNoneMatch),
+		IfModifiedSince: c.Get(fiber.HeaderIfModifiedSince),
+	}
+
+	transform, err := imageTransform(c)
+	if err != nil {
+		return h.shareError(c, err, "")
+	}
+
+	conditions.Transform = transform
+
+	media, err := h.shareService.GetSharedFile(c.Params("token"), c.Get(HeaderSharePassword), fileId, conditions)
+	if err != nil {
+		if errors.Is(err, helper.ErrRangeNotSatisfiable) && media.File != nil {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", media.File.Size))
+
+			return c.SendStatus(http.StatusRequestedRangeNotSatisfiable)
+		}
+
+		return h.shareError(c, err, "Failed to get shared file")
+	}
+
+	// the link may be revoked at any time, so no cache may answer for it
+	return sendMedia(c, media, transform != nil, false)
+}
+
+// optionalUUID parses an optional id, nil when it is empty
+func optionalUUID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+func (h *shareHandler) shareError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrShareNotFound),
+		errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFileNotFound), errors.Is(err, config.ErrObjectNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		resp.Message = core_service.ErrFileNotFound.Error()
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrShareExpired),
+		errors.Is(err, core_service.ErrShareRevoked),
+		errors.Is(err, core_service.ErrShareDownloadLimit),
+		errors.Is(err, core_service.ErrFileExpired):
+		resp.Status = constants.ClientErrorGone
+		return c.Status(http.StatusGone).JSON(resp)
+	case errors.Is(err, core_service.ErrSharePasswordRequired),
+		errors.Is(err, core_service.ErrInvalidSharePassword):
+		resp.Status = constants.ClientErrorUnauthorizedAccess
+		return c.Status(http.StatusUnauthorized).JSON(resp)
+	case errors.Is(err, core_service.ErrFileQuarantined):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidShareTarget),
+		errors.Is(err, core_service.ErrInvalidSharePolicy),
+		errors.Is(err, core_service.ErrInvalidExpiry),
+		errors.Is(err, core_service.ErrNotAnImage),
+		errors.Is(err, core_service.ErrInvalidTransform),
+		errors.Is(err, helper.ErrUnsupportedImage),
+		errors.Is(err, helper.ErrImageTooLarge):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
@@ -0,0 +1,205 @@
+package core_handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/payload/request"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+type TagHandlerInterface interface {
+	GetTags(c *fiber.Ctx) error
+	CreateTag(c *fiber.Ctx) error
+	UpdateTag(c *fiber.Ctx) error
+	DeleteTag(c *fiber.Ctx) error
+	TagItems(c *fiber.Ctx) error
+	UntagItems(c *fiber.Ctx) error
+}
+
+type tagHandler struct {
+	tagService core_service.TagServiceInterface
+}
+
+func NewTagHandler(tagService core_service.TagServiceInterface) TagHandlerInterface {
+	return &tagHandler{tagService: tagService}
+}
+
+func (h *tagHandler) GetTags(c *fiber.Ctx) error {
+	var resp response.Response
+
+	tags, err := h.tagService.FindTags(handler.GetUserId(c))
+	if err != nil {
+		return h.tagError(c, err, "Failed to get tags")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Tags fetched successfully"
+	resp.Data = map[string]interface{}{"result": tags}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *tagHandler) CreateTag(c *fiber.Ctx) error {
+	var resp response.Response
+	var createTagReq request.CreateTagRequest
+
+	if err := c.BodyParser(&createTagReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	tag, err := h.tagService.CreateTag(dto.TagDTO{
+		UserID: handler.GetUserId(c),
+		Name:   createTagReq.Name,
+		Color:  createTagReq.Color,
+	})
+	if err != nil {
+		return h.tagError(c, err, "Failed to create tag")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Tag created successfully"
+	resp.Data = map[string]interface{}{"result": tag}
+
+	return c.Status(http.StatusCreated).JSON(resp)
+}
+
+func (h *tagHandler) UpdateTag(c *fiber.Ctx) error {
+	var resp response.Response
+	var updateTagReq request.UpdateTagRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.tagError(c, core_service.ErrTagNotFound, "")
+	}
+
+	if err := c.BodyParser(&updateTagReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	tag, err := h.tagService.UpdateTag(id, handler.GetUserId(c), updateTagReq.Name, updateTagReq.Color)
+	if err != nil {
+		return h.tagError(c, err, "Failed to update tag")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Tag updated successfully"
+	resp.Data = map[string]interface{}{"result": tag}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *tagHandler) DeleteTag(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.tagError(c, core_service.ErrTagNotFound, "")
+	}
+
+	if err := h.tagService.DeleteTag(id, handler.GetUserId(c)); err != nil {
+		return h.tagError(c, err, "Failed to delete tag")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Tag deleted successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *tagHandler) TagItems(c *fiber.Ctx) error {
+	var resp response.Response
+
+	items, err := h.tagItems(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.tagService.TagItems(handler.GetUserId(c), items); err != nil {
+		return h.tagError(c, err, "Failed to tag items")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Items tagged successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+func (h *tagHandler) UntagItems(c *fiber.Ctx) error {
+	var resp response.Response
+
+	items, err := h.tagItems(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.tagService.UntagItems(handler.GetUserId(c), items); err != nil {
+		return h.tagError(c, err, "Failed to untag items")
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Items untagged successfully"
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// tagItems parses the selection of a bulk tag or untag request, it responds itself when the body is invalid
+func (h *tagHandler) tagItems(c *fiber.Ctx) (dto.TagItemsDTO, error) {
+	var resp response.Response
+	var tagItemsReq request.TagItemsRequest
+
+	if err := c.BodyParser(&tagItemsReq); err != nil {
+		resp.Status = constants.ClientUnProcessableEntity
+		resp.Message = "Invalid request"
+
+		return dto.TagItemsDTO{}, c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	return dto.TagItemsDTO{
+		TagIDs:    tagItemsReq.TagIDs,
+		FileIDs:   tagItemsReq.FileIDs,
+		FolderIDs: tagItemsReq.FolderIDs,
+	}, nil
+}
+
+func (h *tagHandler) tagError(c *fiber.Ctx, err error, fallback string) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrTagNotFound),
+		errors.Is(err, core_service.ErrFileNotFound),
+		errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrTagExists):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusConflict).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidTagName),
+		errors.Is(err, core_service.ErrInvalidTagColor),
+		errors.Is(err, core_service.ErrNoTagsSelected),
+		errors.Is(err, core_service.ErrNoFilesSelected),
+		errors.Is(err, core_service.ErrTooManyFiles):
+		resp.Status = constants.ClientRequestValidationError
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorDatabase
+	resp.Message = fallback
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
@@ -0,0 +1,280 @@
+package core_handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+// UploadHandlerInterface implements the tus 1.0 core protocol with the creation and termination extensions
+type UploadHandlerInterface interface {
+	TusResumable(c *fiber.Ctx) error
+	Options(c *fiber.Ctx) error
+	CreateUpload(c *fiber.Ctx) error
+	GetUploadOffset(c *fiber.Ctx) error
+	PatchUpload(c *fiber.Ctx) error
+	TerminateUpload(c *fiber.Ctx) error
+}
+
+type uploadHandler struct {
+	uploadService core_service.UploadServiceInterface
+}
+
+func NewUploadHandler(uploadService core_service.UploadServiceInterface) UploadHandlerInterface {
+	return &uploadHandler{uploadService: uploadService}
+}
+
+// TusResumable sets the protocol version on every response and rejects clients speaking another version
+func (h *uploadHandler) TusResumable(c *fiber.Ctx) error {
+	var resp response.Response
+
+	c.Set("Tus-Resumable", constants.TusVersion)
+
+	if c.Method() == fiber.MethodOptions {
+		return c.Next()
+	}
+
+	if c.Get("Tus-Resumable") != constants.TusVersion {
+		c.Set("Tus-Version", constants.TusVersion)
+
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Unsupported tus version"
+
+		return c.Status(http.StatusPreconditionFailed).JSON(resp)
+	}
+
+	return c.Next()
+}
+
+func (h *uploadHandler) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Version", constants.TusVersion)
+	c.Set("Tus-Extension", constants.TusExtensions)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *uploadHandler) CreateUpload(c *fiber.Ctx) error {
+	var resp response.Response
+	var uploadDto dto.UploadSessionDTO
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Upload-Length header is required"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	metadata, err := h.parseMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Invalid Upload-Metadata header"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	uploadDto.UserID = handler.GetUserId(c)
+	uploadDto.Length = length
+	uploadDto.OriginalName = metadata["filename"]
+	uploadDto.MimeType = metadata["filetype"]
+	uploadDto.Visibility = metadata["visibility"]
+
+	if uploadDto.OriginalName == "" {
+		uploadDto.OriginalName = "upload"
+	}
+
+	if uploadDto.MimeType == "" {
+		uploadDto.MimeType = "application/octet-stream"
+	}
+
+	if folderId := metadata["folder_id"]; folderId != "" {
+		folderUUID, err := uuid.Parse(folderId)
+		if err != nil {
+			resp.Status = constants.ClientUnProcessableEntity
+			resp.Message = "Invalid folder ID"
+
+			return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+		}
+		uploadDto.FolderID = &folderUUID
+	}
+
+	upload, err := h.uploadService.CreateUpload(uploadDto)
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	c.Set("Location", fmt.Sprintf("%s/%s/%s", constants.APP_URL, "upload", upload.ID))
+	h.setUploadHeaders(c, upload)
+
+	return c.SendStatus(http.StatusCreated)
+}
+
+func (h *uploadHandler) GetUploadOffset(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.SendStatus(http.StatusNotFound)
+	}
+
+	upload, err := h.uploadService.GetUpload(id, handler.GetUserId(c))
+	if err != nil {
+		return h.uploadError(c, err)
+	}
+
+	c.Set("Cache-Control", "no-store")
+	h.setUploadHeaders(c, upload)
+
+	return c.SendStatus(http.StatusOK)
+}
+
+func (h *uploadHandler) PatchUpload(c *fiber.Ctx) error {
+	var resp response.Response
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.SendStatus(http.StatusNotFound)
+	}
+
+	if c.Get(fiber.HeaderContentType) != constants.TusContentType {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Content-Type must be " + constants.TusContentType
+
+		return c.Status(http.StatusUnsupportedMediaType).JSON(resp)
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		resp.Status = constants.ClientErrorBadRequest
+		resp.Message = "Upload-Offset header is required"
+
+		return c.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	upload, err := h.uploadService.AppendChunk(id, handler.GetUserId(c), offset, body)
+	if err != nil {
+		// the rest of the body is left unread, so the connection can't be reused
+		c.Context().SetConnectionClose()
+
+		return h.uploadError(c, err)
+	}
+
+	h.setUploadHeaders(c, upload)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *uploadHandler) TerminateUpload(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.SendStatus(http.StatusNotFound)
+	}
+
+	if err := h.uploadService.TerminateUpload(id, handler.GetUserId(c)); err != nil {
+		return h.uploadError(c, err)
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *uploadHandler) setUploadHeaders(c *fiber.Ctx, upload dto.UploadSessionDTO) {
+	c.Set("Upload-Offset", helper.Int64ToString(upload.Offset))
+	c.Set("Upload-Length", helper.Int64ToString(upload.Length))
+
+	if upload.File != nil {
+		c.Set("X-File-Id", upload.File.ID.String())
+
+		if upload.File.Key != "" {
+			c.Set("X-File-Key", upload.File.Key)
+		}
+	}
+}
+
+func (h *uploadHandler) uploadError(c *fiber.Ctx, err error) error {
+	var resp response.Response
+
+	resp.Message = err.Error()
+
+	switch {
+	case errors.Is(err, core_service.ErrUploadNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderNotFound):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusNotFound).JSON(resp)
+	case errors.Is(err, core_service.ErrFolderAccessDenied):
+		resp.Status = constants.ClientErrorForbidden
+		return c.Status(http.StatusForbidden).JSON(resp)
+	case errors.Is(err, core_service.ErrUploadExpired):
+		resp.Status = constants.ClientErrorResourceNotFound
+		return c.Status(http.StatusGone).JSON(resp)
+	case errors.Is(err, core_service.ErrUploadOffsetMismatch):
+		resp.Status = constants.ClientErrorBadRequest
+		return c.Status(http.StatusConflict).JSON(resp)
+	case errors.Is(err, helper.ErrBodyTooLarge):
+		resp.Status = constants.ClientErrorPayloadTooLarge
+		resp.Message = "Upload exceeds the upload limit of your plan"
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(resp)
+	case errors.Is(err, core_service.ErrInvalidVisibility):
+		resp.Status = constants.ClientUnProcessableEntity
+		return c.Status(http.StatusUnprocessableEntity).JSON(resp)
+	case errors.Is(err, core_service.ErrContentTypeBlocked),
+		errors.Is(err, core_service.ErrContentTypeNotAllowed),
+		errors.Is(err, core_service.ErrContentTypeMismatch):
+		resp.Status = constants.ClientErrorUnsupportedType
+		return c.Status(http.StatusUnsupportedMediaType).JSON(resp)
+	case errors.Is(err, core_service.ErrStorageQuotaExceeded):
+		resp.Status = constants.ClientErrorQuotaExceeded
+		return c.Status(http.StatusInsufficientStorage).JSON(resp)
+	}
+
+	resp.Status = constants.ServerErrorExternalService
+
+	return c.Status(http.StatusInternalServerError).JSON(resp)
+}
+
+// parseMetadata decodes an Upload-Metadata header of comma separated "key base64(value)" pairs
+func (h *uploadHandler) parseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) > 2 {
+			return nil, errors.New("invalid metadata pair")
+		}
+
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+
+		metadata[fields[0]] = value
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,43 @@
+package core_handler
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shordem/api.thryvo/handler"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/payload/response"
+	core_service "github.com/shordem/api.thryvo/service/core"
+)
+
+type UsageHandlerInterface interface {
+	GetUsage(c *fiber.Ctx) error
+}
+
+type usageHandler struct {
+	usageService core_service.StorageUsageServiceInterface
+}
+
+func NewUsageHandler(usageService core_service.StorageUsageServiceInterface) UsageHandlerInterface {
+	return &usageHandler{usageService: usageService}
+}
+
+// GetUsage reports the bytes the user has stored against the storage quota of their plan
+func (h *usageHandler) GetUsage(c *fiber.Ctx) error {
+	var resp response.Response
+
+	usage, err := h.usageService.GetUsage(handler.GetUserId(c))
+	if err != nil {
+		resp.Status = constants.ServerErrorInternal
+		resp.Message = "Failed to get storage usage"
+
+		return c.Status(http.StatusInternalServerError).JSON(resp)
+	}
+
+	resp.Status = constants.SuccessOperationCompleted
+	resp.Message = "Storage usage fetched successfully"
+	resp.Data = map[string]interface{}{"result": usage}
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
@@ -1,13 +1,19 @@
 package handler
 
 import (
+	"bytes"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
 
 	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/lib/helper"
 	"github.com/shordem/api.thryvo/payload/response"
 	"github.com/shordem/api.thryvo/repository"
 )
@@ -18,6 +24,59 @@ func GetUserId(c *fiber.Ctx) uuid.UUID {
 	return userId
 }
 
+// GetOptionalUserId returns the authenticated user on routes where authentication is optional
+func GetOptionalUserId(c *fiber.Ctx) *uuid.UUID {
+	userId, ok := c.Locals("userId").(uuid.UUID)
+	if !ok {
+		return nil
+	}
+
+	return &userId
+}
+
+// MaxFormValueSize caps the non-file fields of a streamed multipart body
+const MaxFormValueSize = 64 * 1024
+
+// MultipartStream returns a reader over the raw multipart body so file parts can be consumed as
+// they arrive instead of being buffered. The body is capped at the limit set by UploadLimit.
+func MultipartStream(c *fiber.Ctx) (*multipart.Reader, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, fasthttp.ErrNoMultipartForm
+	}
+
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	if limit, ok := c.Locals("uploadLimit").(int64); ok && limit > 0 {
+		body = helper.NewLimitedReader(body, limit)
+	}
+
+	return multipart.NewReader(body, boundary), nil
+}
+
+// ReadFormValue reads the value of a non-file multipart part
+func ReadFormValue(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(helper.NewLimitedReader(part, MaxFormValueSize))
+
+	return string(value), err
+}
+
+// DiscardMultipart consumes what is left of a streamed multipart body so the connection can be reused
+func DiscardMultipart(reader *multipart.Reader) error {
+	for {
+		if _, err := reader.NextPart(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
 func Index(c *fiber.Ctx) error {
 
 	var resp response.Response
@@ -101,9 +160,11 @@ func GeneratePageable(context *fiber.Ctx) (pageable repository.Pageable) {
 		pageable.SortBy = orderBy
 	}
 
-	sortDir := context.Query("sort_dir", "")
-	if sortDir != "" {
-		pageable.SortBy = sortDir
+	// sort_dir sets the direction, it used to overwrite the sort column. Repositories build ORDER BY from
+	// it, so only asc and desc are taken.
+	sortDir := strings.ToLower(context.Query("sort_dir", ""))
+	if sortDir == "asc" || sortDir == "desc" {
+		pageable.SortDirection = sortDir
 	}
 
 	search := context.Query("search", "")
@@ -1,16 +1,12 @@
 package config
 
 import (
-	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"strings"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"time"
 
 	"github.com/shordem/api.thryvo/dto"
 	"github.com/shordem/api.thryvo/lib/constants"
@@ -18,96 +14,98 @@ import (
 )
 
 type FileConfigInterface interface {
-	UploadFile(userId string, file *multipart.FileHeader) (string, error)
-	GetObject(path string) (dto.GetFileDTO, error)
+	UploadFile(userId string, fileName string, contentType string, body io.Reader, encryptionKey []byte) (dto.StoredObjectDTO, error)
+	PutObject(path string, body io.Reader, size int64, contentType string) error
+	GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error)
+	HeadObject(path string) (dto.ObjectInfoDTO, error)
 	DeleteObject(key string) error
+	ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error
+	PresignPutObject(path string, contentType string, expires time.Duration) (string, error)
+	FileKey(name string, contentType string) string
 	GetObjectPath(userId string, key string) string
 }
 
 type file struct {
-	bucket  string
-	service *s3.S3
+	driver StorageDriverInterface
 }
 
 func NewFileConfig(env constants.Env) FileConfigInterface {
-	return &file{
-		bucket:  env.AWS_BUCKET,
-		service: s3.New(AWSConfig(env.AWS_REGION, env.AWS_ACCESS_KEY, env.AWS_SECRET_KEY)),
-	}
+	return NewFileConfigWithDriver(NewStorageDriver(env))
 }
 
-func AWSConfig(region string, accessKey string, secretKey string) *session.Session {
-	return session.Must(session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
-	}))
+func NewFileConfigWithDriver(driver StorageDriverInterface) FileConfigInterface {
+	return &file{driver: driver}
 }
 
-func (m *file) UploadFile(userId string, file *multipart.FileHeader) (string, error) {
-	key := m.FileKey(file.Filename)
+// UploadFile streams body to storage under a freshly generated key without buffering it,
+// hashing the content on the way through. The content is encrypted with encryptionKey when it is set,
+// size and digests still describe the plaintext.
+func (m *file) UploadFile(userId string, fileName string, contentType string, body io.Reader, encryptionKey []byte) (dto.StoredObjectDTO, error) {
+	key := m.FileKey(fileName, contentType)
 	path := m.GetObjectPath(userId, key)
-	fileOpen, openErr := file.Open()
-
-	if openErr != nil {
-		return "", openErr
+	hash := sha256.New()
+	md5Hash := md5.New()
+	counter := &helper.CountingReader{Reader: io.TeeReader(body, io.MultiWriter(hash, md5Hash))}
+
+	var object io.Reader = counter
+	if encryptionKey != nil {
+		encrypted, err := helper.NewEncryptingReader(counter, encryptionKey)
+		if err != nil {
+			return dto.StoredObjectDTO{}, err
+		}
+
+		object = encrypted
 	}
 
-	defer fileOpen.Close()
-
-	fileContent := new(bytes.Buffer)
-
-	_, copyErr := io.Copy(fileContent, fileOpen)
+	if err := m.driver.PutObject(path, object, -1, contentType); err != nil {
+		if counter.Err != nil {
+			return dto.StoredObjectDTO{}, counter.Err
+		}
 
-	if copyErr != nil {
-		return "", copyErr
+		return dto.StoredObjectDTO{}, err
 	}
 
-	// Uploads the object to S3
-	_, err := m.service.PutObject(&s3.PutObjectInput{
-		Bucket: helper.StringToPointer(m.bucket),
-		Key:    helper.StringToPointer(path),
-		Body:   bytes.NewReader(fileContent.Bytes()),
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return key, nil
+	return dto.StoredObjectDTO{
+		Key:  key,
+		Size: counter.Count,
+		Hash: hex.EncodeToString(hash.Sum(nil)),
+		MD5:  hex.EncodeToString(md5Hash.Sum(nil)),
+	}, nil
 }
 
-func (m *file) GetObject(path string) (dto.GetFileDTO, error) {
-	var media dto.GetFileDTO
-
-	// Downloads the object to a file
-	obj, err := m.service.GetObject(&s3.GetObjectInput{
-		Bucket: helper.StringToPointer(m.bucket),
-		Key:    helper.StringToPointer(path),
-	})
-
-	if err != nil {
-		return dto.GetFileDTO{}, err
-	}
+func (m *file) PutObject(path string, body io.Reader, size int64, contentType string) error {
+	return m.driver.PutObject(path, body, size, contentType)
+}
 
-	media.Body = obj.Body
-	media.ContentType = obj.ContentType
-	media.ContentLength = obj.ContentLength
+// GetObject reads an object, or only byteRange of it when set
+func (m *file) GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error) {
+	return m.driver.GetObject(path, byteRange)
+}
 
-	return media, nil
+func (m *file) HeadObject(path string) (dto.ObjectInfoDTO, error) {
+	return m.driver.HeadObject(path)
 }
 
 func (m *file) DeleteObject(key string) error {
-	_, err := m.service.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: helper.StringToPointer(m.bucket),
-		Key:    helper.StringToPointer(key),
-	})
+	return m.driver.DeleteObject(key)
+}
 
-	return err
+func (m *file) ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error {
+	return m.driver.ListObjects(prefix, each)
 }
 
-func (m *file) FileKey(name string) string {
+func (m *file) PresignPutObject(path string, contentType string, expires time.Duration) (string, error) {
+	return m.driver.PresignPutObject(path, contentType, expires)
+}
+
+// FileKey generates a unique key, keeping the extension of name when it matches contentType
+func (m *file) FileKey(name string, contentType string) string {
 	filename, _ := helper.GenerateSnowflakeID()
-	fileExt := strings.Split(name, ".")[len(strings.Split(name, "."))-1]
+
+	fileExt := helper.FileExtension(name, contentType)
+	if fileExt == "" {
+		return fmt.Sprintf("%d", filename)
+	}
 
 	return fmt.Sprintf("%d.%s", filename, fileExt)
 }
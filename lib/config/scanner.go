@@ -0,0 +1,35 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/constants"
+)
+
+var (
+	ScannerClamd = "clamd"
+	ScannerNone  = "none"
+)
+
+// ErrScanFailed is returned when the scanner could not scan a particular piece of content, for instance
+// because it is larger than the scanner accepts. Other errors mean the scanner itself is unavailable.
+var ErrScanFailed = errors.New("content could not be scanned")
+
+// ScannerInterface is implemented by every malware scanner uploads can be checked with.
+// Scan must consume body as a stream, a scanner that doesn't look at content may leave it unread.
+type ScannerInterface interface {
+	Scan(ctx context.Context, body io.Reader) (dto.ScanResultDTO, error)
+}
+
+// NewScanner returns the malware scanner selected by MALWARE_SCANNER, defaulting to none
+func NewScanner(env constants.Env) ScannerInterface {
+	switch env.MALWARE_SCANNER {
+	case ScannerClamd:
+		return NewClamdScanner(env.CLAMD_ADDRESS)
+	default:
+		return NewNoopScanner()
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/helper"
+)
+
+const (
+	// clamdChunkSize is how much content is sent to clamd per INSTREAM chunk
+	clamdChunkSize = 64 * 1024
+	// clamdTimeout bounds a whole scan when the context has no deadline of its own
+	clamdTimeout = 10 * time.Minute
+)
+
+// clamdScanner streams content to a ClamAV daemon with the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+}
+
+// NewClamdScanner connects to clamd at address, a unix:// socket path or a tcp:// (or bare) host:port
+func NewClamdScanner(address string) ScannerInterface {
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		return &clamdScanner{network: "unix", address: path}
+	}
+
+	if address == "" {
+		address = "127.0.0.1:3310"
+	}
+
+	return &clamdScanner{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}
+}
+
+func (s *clamdScanner) Scan(ctx context.Context, body io.Reader) (dto.ScanResultDTO, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return dto.ScanResultDTO{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(clamdTimeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return dto.ScanResultDTO{}, err
+	}
+
+	// clamd stops reading once content goes over its StreamMaxLength and replies with an error, which is
+	// read below even when sending failed. It would wait for the rest of content that failed to read.
+	content := &helper.CountingReader{Reader: body}
+	sendErr := s.send(conn, content)
+	if content.Err != nil {
+		return dto.ScanResultDTO{}, content.Err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		if sendErr != nil {
+			return dto.ScanResultDTO{}, fmt.Errorf("clamd: %w", sendErr)
+		}
+
+		return dto.ScanResultDTO{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	return parseClamdReply(reply)
+}
+
+// send writes the INSTREAM command followed by the content in length prefixed chunks
+func (s *clamdScanner) send(conn net.Conn, body io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 4+clamdChunkSize)
+
+	for {
+		n, err := io.ReadFull(body, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// a zero length chunk ends the stream
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+
+	return err
+}
+
+// parseClamdReply reads replies such as "stream: OK", "stream: Eicar-Signature FOUND" and
+// "INSTREAM size limit exceeded. ERROR"
+func parseClamdReply(reply string) (dto.ScanResultDTO, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	result := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case result == "OK":
+		return dto.ScanResultDTO{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return dto.ScanResultDTO{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	case strings.HasSuffix(result, " ERROR"):
+		return dto.ScanResultDTO{}, fmt.Errorf("%w: clamd: %s", ErrScanFailed, strings.TrimSuffix(result, " ERROR"))
+	}
+
+	return dto.ScanResultDTO{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
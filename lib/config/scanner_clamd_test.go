@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeClamd accepts a single INSTREAM scan on a local port, sends back reply and hands over the content
+// it received
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+
+		command, err := reader.ReadString(0)
+		if err != nil || command != "zINSTREAM\x00" {
+			conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			return
+		}
+
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+
+			if size == 0 {
+				break
+			}
+
+			if _, err := io.CopyN(&content, reader, int64(size)); err != nil {
+				return
+			}
+		}
+
+		received <- content.Bytes()
+		conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return "tcp://" + listener.Addr().String(), received
+}
+
+func TestClamdScanner(t *testing.T) {
+	content := strings.Repeat("thryvo", clamdChunkSize/3)
+
+	tests := []struct {
+		name      string
+		reply     string
+		infected  bool
+		signature string
+		err       error
+	}{
+		{name: "clean", reply: "stream: OK"},
+		{name: "found", reply: "stream: Eicar-Signature FOUND", infected: true, signature: "Eicar-Signature"},
+		{name: "error", reply: "INSTREAM size limit exceeded. ERROR", err: ErrScanFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address, received := fakeClamd(t, test.reply)
+
+			result, err := NewClamdScanner(address).Scan(context.Background(), strings.NewReader(content))
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected %v, got %v", test.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Infected != test.infected || result.Signature != test.signature {
+				t.Fatalf("unexpected result %+v", result)
+			}
+
+			if got := <-received; string(got) != content {
+				t.Fatalf("clamd received %d bytes, expected %d", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	_, err = NewClamdScanner(address).Scan(context.Background(), strings.NewReader("content"))
+	if err == nil || errors.Is(err, ErrScanFailed) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+}
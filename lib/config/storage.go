@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/constants"
+)
+
+var (
+	StorageDriverS3     = "s3"
+	StorageDriverLocal  = "local"
+	StorageDriverMemory = "memory"
+)
+
+var (
+	ErrObjectNotFound      = errors.New("object not found")
+	ErrInvalidObjectPath   = errors.New("invalid object path")
+	ErrPresignNotSupported = errors.New("storage driver does not support presigned uploads")
+)
+
+// StorageDriverInterface is implemented by every backend file contents can be stored in.
+// PutObject must consume body as a stream, size is -1 when the length is not known up front.
+// ListObjects calls each for every object whose path starts with prefix and stops at its first error.
+type StorageDriverInterface interface {
+	PutObject(path string, body io.Reader, size int64, contentType string) error
+	GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error)
+	HeadObject(path string) (dto.ObjectInfoDTO, error)
+	DeleteObject(path string) error
+	ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error
+	PresignPutObject(path string, contentType string, expires time.Duration) (string, error)
+}
+
+// NewStorageDriver returns the storage driver selected by STORAGE_DRIVER, defaulting to S3
+func NewStorageDriver(env constants.Env) StorageDriverInterface {
+	switch env.STORAGE_DRIVER {
+	case StorageDriverLocal:
+		return NewLocalStorage(env.STORAGE_LOCAL_PATH)
+	case StorageDriverMemory:
+		return NewMemoryStorage()
+	default:
+		return NewS3Storage(env)
+	}
+}
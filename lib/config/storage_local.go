@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shordem/api.thryvo/dto"
+)
+
+// localStorage keeps objects as plain files below a root directory, mainly for development
+type localStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) StorageDriverInterface {
+	if root == "" {
+		root = "storage"
+	}
+
+	return &localStorage{root: root}
+}
+
+// resolve maps an object path to a location on disk, refusing paths that escape the root
+func (l *localStorage) resolve(path string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(path))
+	if cleaned == string(filepath.Separator) {
+		return "", ErrInvalidObjectPath
+	}
+
+	full := filepath.Join(l.root, cleaned)
+	if !strings.HasPrefix(full, filepath.Clean(l.root)+string(filepath.Separator)) {
+		return "", ErrInvalidObjectPath
+	}
+
+	return full, nil
+}
+
+func (l *localStorage) PutObject(path string, body io.Reader, size int64, contentType string) error {
+	full, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), full)
+}
+
+func (l *localStorage) GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error) {
+	full, err := l.resolve(path)
+	if err != nil {
+		return dto.GetFileDTO{}, err
+	}
+
+	obj, err := os.Open(full)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dto.GetFileDTO{}, ErrObjectNotFound
+		}
+
+		return dto.GetFileDTO{}, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return dto.GetFileDTO{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(full))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	size := info.Size()
+	modTime := info.ModTime()
+	etag := fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+	var body io.ReadCloser = obj
+
+	if byteRange != nil {
+		if _, err := obj.Seek(byteRange.Start, io.SeekStart); err != nil {
+			obj.Close()
+			return dto.GetFileDTO{}, err
+		}
+
+		size = byteRange.Length()
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(obj, size), obj}
+	}
+
+	return dto.GetFileDTO{
+		Body:          body,
+		ContentType:   &contentType,
+		ContentLength: &size,
+		ETag:          &etag,
+		LastModified:  &modTime,
+		Range:         byteRange,
+	}, nil
+}
+
+func (l *localStorage) HeadObject(path string) (dto.ObjectInfoDTO, error) {
+	full, err := l.resolve(path)
+	if err != nil {
+		return dto.ObjectInfoDTO{}, err
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dto.ObjectInfoDTO{}, ErrObjectNotFound
+		}
+
+		return dto.ObjectInfoDTO{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(full))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return dto.ObjectInfoDTO{
+		Size:         info.Size(),
+		ContentType:  contentType,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (l *localStorage) DeleteObject(path string) error {
+	full, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// ListObjects walks the directory holding prefix, temporary files of writes in progress are left out
+func (l *localStorage) ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error {
+	root := filepath.Clean(l.root)
+
+	dir := filepath.Join(root, filepath.FromSlash(prefix))
+	if !strings.HasSuffix(prefix, "/") {
+		dir = filepath.Dir(dir)
+	}
+
+	if dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return ErrInvalidObjectPath
+	}
+
+	err := filepath.WalkDir(dir, func(full string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, full)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.ToSlash(rel)
+		if !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		return each(dto.ListedObjectDTO{Path: path, Size: info.Size(), LastModified: info.ModTime()})
+	})
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (l *localStorage) PresignPutObject(path string, contentType string, expires time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shordem/api.thryvo/dto"
+)
+
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// memoryStorage keeps objects in process memory, it is meant for tests and throwaway environments
+type memoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStorage() StorageDriverInterface {
+	return &memoryStorage{objects: map[string]memoryObject{}}
+}
+
+func (m *memoryStorage) PutObject(path string, body io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[path] = memoryObject{data: data, contentType: contentType, lastModified: time.Now()}
+
+	return nil
+}
+
+func (m *memoryStorage) GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error) {
+	m.mu.RLock()
+	obj, ok := m.objects[path]
+	m.mu.RUnlock()
+
+	if !ok {
+		return dto.GetFileDTO{}, ErrObjectNotFound
+	}
+
+	contentType := obj.contentType
+	lastModified := obj.lastModified
+	etag := fmt.Sprintf(`"%x-%x"`, lastModified.UnixNano(), len(obj.data))
+	data := obj.data
+
+	if byteRange != nil {
+		start, end := byteRange.Start, byteRange.End+1
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		if start > end {
+			start = end
+		}
+
+		data = data[start:end]
+	}
+
+	size := int64(len(data))
+
+	return dto.GetFileDTO{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentType:   &contentType,
+		ContentLength: &size,
+		ETag:          &etag,
+		LastModified:  &lastModified,
+		Range:         byteRange,
+	}, nil
+}
+
+func (m *memoryStorage) HeadObject(path string) (dto.ObjectInfoDTO, error) {
+	m.mu.RLock()
+	obj, ok := m.objects[path]
+	m.mu.RUnlock()
+
+	if !ok {
+		return dto.ObjectInfoDTO{}, ErrObjectNotFound
+	}
+
+	return dto.ObjectInfoDTO{
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		LastModified: obj.lastModified,
+	}, nil
+}
+
+func (m *memoryStorage) DeleteObject(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, path)
+
+	return nil
+}
+
+func (m *memoryStorage) ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error {
+	m.mu.RLock()
+	objects := []dto.ListedObjectDTO{}
+	for path, obj := range m.objects {
+		if strings.HasPrefix(path, prefix) {
+			objects = append(objects, dto.ListedObjectDTO{Path: path, Size: int64(len(obj.data)), LastModified: obj.lastModified})
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+
+	for _, object := range objects {
+		if err := each(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) PresignPutObject(path string, contentType string, expires time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/constants"
+	"github.com/shordem/api.thryvo/lib/helper"
+)
+
+var (
+	// S3PartSize is the size of each part of a multipart upload, objects smaller than this are sent in a single request
+	S3PartSize int64 = 8 * 1024 * 1024
+	// S3UploadConcurrency is the number of parts uploaded in parallel, memory use per upload is roughly S3PartSize * S3UploadConcurrency
+	S3UploadConcurrency = 3
+)
+
+type s3Storage struct {
+	bucket   string
+	service  *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func NewS3Storage(env constants.Env) StorageDriverInterface {
+	service := s3.New(AWSConfig(env.AWS_REGION, env.AWS_ACCESS_KEY, env.AWS_SECRET_KEY))
+
+	return &s3Storage{
+		bucket:  env.AWS_BUCKET,
+		service: service,
+		uploader: s3manager.NewUploaderWithClient(service, func(u *s3manager.Uploader) {
+			u.PartSize = S3PartSize
+			u.Concurrency = S3UploadConcurrency
+		}),
+	}
+}
+
+func AWSConfig(region string, accessKey string, secretKey string) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+	}))
+}
+
+// PutObject streams body to the bucket, switching to a multipart upload once it grows past S3PartSize
+func (s *s3Storage) PutObject(path string, body io.Reader, size int64, contentType string) error {
+	input := &s3manager.UploadInput{
+		Bucket: helper.StringToPointer(s.bucket),
+		Key:    helper.StringToPointer(path),
+		Body:   body,
+	}
+
+	if contentType != "" {
+		input.ContentType = helper.StringToPointer(contentType)
+	}
+
+	_, err := s.uploader.Upload(input)
+
+	return err
+}
+
+func (s *s3Storage) GetObject(path string, byteRange *dto.ByteRange) (dto.GetFileDTO, error) {
+	var media dto.GetFileDTO
+
+	input := &s3.GetObjectInput{
+		Bucket: helper.StringToPointer(s.bucket),
+		Key:    helper.StringToPointer(path),
+	}
+
+	if byteRange != nil {
+		input.Range = helper.StringToPointer(fmt.Sprintf("bytes=%d-%d", byteRange.Start, byteRange.End))
+	}
+
+	obj, err := s.service.GetObject(input)
+
+	if err != nil {
+		return dto.GetFileDTO{}, s3Error(err)
+	}
+
+	media.Body = obj.Body
+	media.ContentType = obj.ContentType
+	media.ContentLength = obj.ContentLength
+	media.ETag = obj.ETag
+	media.LastModified = obj.LastModified
+	media.Range = byteRange
+
+	return media, nil
+}
+
+func (s *s3Storage) HeadObject(path string) (dto.ObjectInfoDTO, error) {
+	obj, err := s.service.HeadObject(&s3.HeadObjectInput{
+		Bucket: helper.StringToPointer(s.bucket),
+		Key:    helper.StringToPointer(path),
+	})
+
+	if err != nil {
+		return dto.ObjectInfoDTO{}, s3Error(err)
+	}
+
+	return dto.ObjectInfoDTO{
+		Size:         aws.Int64Value(obj.ContentLength),
+		ContentType:  aws.StringValue(obj.ContentType),
+		LastModified: aws.TimeValue(obj.LastModified),
+	}, nil
+}
+
+func (s *s3Storage) DeleteObject(path string) error {
+	_, err := s.service.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: helper.StringToPointer(s.bucket),
+		Key:    helper.StringToPointer(path),
+	})
+
+	return err
+}
+
+func (s *s3Storage) ListObjects(prefix string, each func(object dto.ListedObjectDTO) error) error {
+	var eachErr error
+
+	err := s.service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: helper.StringToPointer(s.bucket),
+		Prefix: helper.StringToPointer(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			eachErr = each(dto.ListedObjectDTO{
+				Path:         aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+
+			if eachErr != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	if eachErr != nil {
+		return eachErr
+	}
+
+	return err
+}
+
+// PresignPutObject returns a URL the client can PUT the object body to directly, the request
+// must carry the same Content-Type header that was signed
+func (s *s3Storage) PresignPutObject(path string, contentType string, expires time.Duration) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket: helper.StringToPointer(s.bucket),
+		Key:    helper.StringToPointer(path),
+	}
+
+	if contentType != "" {
+		input.ContentType = helper.StringToPointer(contentType)
+	}
+
+	req, _ := s.service.PutObjectRequest(input)
+
+	return req.Presign(expires)
+}
+
+// s3Error maps missing object errors to ErrObjectNotFound
+func s3Error(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrObjectNotFound
+		}
+	}
+
+	return err
+}
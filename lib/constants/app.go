@@ -3,3 +3,26 @@ package constants
 const (
 	APP_URL = "https://api.thryvo.buimas.com/v1"
 )
+
+const (
+	TusVersion     = "1.0.0"
+	TusExtensions  = "creation,termination"
+	TusContentType = "application/offset+octet-stream"
+)
+
+const (
+	// MaxBufferedBodySize is the largest request body kept in memory, larger bodies are streamed
+	MaxBufferedBodySize = 4 * 1024 * 1024
+
+	// FreeTierMaxUploadSize applies to users without an active subscription or whose plan sets no limit
+	FreeTierMaxUploadSize int64 = 10 * 1024 * 1024
+
+	// FreeTierMaxFileVersions is how many versions of a file are kept without a plan that sets more
+	FreeTierMaxFileVersions = 5
+
+	// FreeTierStorageQuota is how many bytes a user can store without a plan that sets more
+	FreeTierStorageQuota int64 = 1024 * 1024 * 1024
+
+	// FreeTierMaxArchiveSize is how many bytes of files one archive download can hold without a plan that sets more
+	FreeTierMaxArchiveSize int64 = 2 * 1024 * 1024 * 1024
+)
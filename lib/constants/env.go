@@ -1,7 +1,9 @@
 package constants
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 
@@ -14,6 +16,20 @@ type Env struct {
 	AWS_REGION     string
 	AWS_BUCKET     string
 
+	STORAGE_DRIVER     string
+	STORAGE_LOCAL_PATH string
+
+	FILE_URL_SECRET      string
+	TRASH_RETENTION_DAYS string
+	MIME_MISMATCH_POLICY string
+
+	STORAGE_RECONCILE_REPAIR string
+	ENCRYPTION_MASTER_KEYS   string
+
+	MALWARE_SCANNER     string
+	CLAMD_ADDRESS       string
+	SCAN_FAILURE_POLICY string
+
 	PORT string
 
 	DB_HOST        string
@@ -40,8 +56,11 @@ type Env struct {
 	PAYMENT_CALLBACK_URL   string
 }
 
+// init loads .env when there is one, without it the variables come from the process environment alone
 func init() {
-	if err := godotenv.Load(); err != nil {
+	if err := godotenv.Load(); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("No .env file, using the environment")
+	} else if err != nil {
 		log.Fatal("Error loading .env file")
 	} else {
 		fmt.Println("Loaded .env file")
@@ -50,28 +69,38 @@ func init() {
 
 func GetEnv() Env {
 	return Env{
-		AWS_SECRET_KEY:         os.Getenv("AWS_SECRET_KEY"),
-		AWS_ACCESS_KEY:         os.Getenv("AWS_ACCESS_KEY"),
-		AWS_REGION:             os.Getenv("AWS_REGION"),
-		AWS_BUCKET:             os.Getenv("AWS_BUCKET"),
-		PORT:                   os.Getenv("PORT"),
-		DB_HOST:                os.Getenv("DB_HOST"),
-		DB_USER:                os.Getenv("DB_USER"),
-		DB_PASSWORD:            os.Getenv("DB_PASSWORD"),
-		DB_PORT:                os.Getenv("DB_PORT"),
-		DB_NAME:                os.Getenv("DB_NAME"),
-		REDIS_SERVER:           os.Getenv("REDIS_SERVER"),
-		REDIS_PASSWORD:         os.Getenv("REDIS_PASSWORD"),
-		JWT_ACCESS_SECRET:      os.Getenv("JWT_ACCESS_SECRET"),
-		JWT_REFRESH_SECRET:     os.Getenv("JWT_REFRESH_SECRET"),
-		FROM_EMAIL:             os.Getenv("FROM_EMAIL"),
-		SMTP_HOST:              os.Getenv("SMTP_HOST"),
-		SMTP_PORT:              os.Getenv("SMTP_PORT"),
-		SMTP_USERNAME:          os.Getenv("SMTP_USERNAME"),
-		SMTP_PASSWORD:          os.Getenv("SMTP_PASSWORD"),
-		RABBITMQ_SERVER:        os.Getenv("RABBITMQ_SERVER"),
-		PAYSTACK_SECRET_KEY:    os.Getenv("PAYSTACK_SECRET_KEY"),
-		FLUTTERWAVE_SECRET_KEY: os.Getenv("FLUTTERWAVE_SECRET_KEY"),
-		PAYMENT_CALLBACK_URL:   os.Getenv("PAYMENT_CALLBACK_URL"),
+		AWS_SECRET_KEY:           os.Getenv("AWS_SECRET_KEY"),
+		AWS_ACCESS_KEY:           os.Getenv("AWS_ACCESS_KEY"),
+		AWS_REGION:               os.Getenv("AWS_REGION"),
+		AWS_BUCKET:               os.Getenv("AWS_BUCKET"),
+		STORAGE_DRIVER:           os.Getenv("STORAGE_DRIVER"),
+		STORAGE_LOCAL_PATH:       os.Getenv("STORAGE_LOCAL_PATH"),
+		FILE_URL_SECRET:          os.Getenv("FILE_URL_SECRET"),
+		TRASH_RETENTION_DAYS:     os.Getenv("TRASH_RETENTION_DAYS"),
+		MIME_MISMATCH_POLICY:     os.Getenv("MIME_MISMATCH_POLICY"),
+		STORAGE_RECONCILE_REPAIR: os.Getenv("STORAGE_RECONCILE_REPAIR"),
+		ENCRYPTION_MASTER_KEYS:   os.Getenv("ENCRYPTION_MASTER_KEYS"),
+		MALWARE_SCANNER:          os.Getenv("MALWARE_SCANNER"),
+		CLAMD_ADDRESS:            os.Getenv("CLAMD_ADDRESS"),
+		SCAN_FAILURE_POLICY:      os.Getenv("SCAN_FAILURE_POLICY"),
+		PORT:                     os.Getenv("PORT"),
+		DB_HOST:                  os.Getenv("DB_HOST"),
+		DB_USER:                  os.Getenv("DB_USER"),
+		DB_PASSWORD:              os.Getenv("DB_PASSWORD"),
+		DB_PORT:                  os.Getenv("DB_PORT"),
+		DB_NAME:                  os.Getenv("DB_NAME"),
+		REDIS_SERVER:             os.Getenv("REDIS_SERVER"),
+		REDIS_PASSWORD:           os.Getenv("REDIS_PASSWORD"),
+		JWT_ACCESS_SECRET:        os.Getenv("JWT_ACCESS_SECRET"),
+		JWT_REFRESH_SECRET:       os.Getenv("JWT_REFRESH_SECRET"),
+		FROM_EMAIL:               os.Getenv("FROM_EMAIL"),
+		SMTP_HOST:                os.Getenv("SMTP_HOST"),
+		SMTP_PORT:                os.Getenv("SMTP_PORT"),
+		SMTP_USERNAME:            os.Getenv("SMTP_USERNAME"),
+		SMTP_PASSWORD:            os.Getenv("SMTP_PASSWORD"),
+		RABBITMQ_SERVER:          os.Getenv("RABBITMQ_SERVER"),
+		PAYSTACK_SECRET_KEY:      os.Getenv("PAYSTACK_SECRET_KEY"),
+		FLUTTERWAVE_SECRET_KEY:   os.Getenv("FLUTTERWAVE_SECRET_KEY"),
+		PAYMENT_CALLBACK_URL:     os.Getenv("PAYMENT_CALLBACK_URL"),
 	}
 }
@@ -16,6 +16,10 @@ const (
 	ClientErrorResourceNotFound   = 4004
 	ClientRequestValidationError  = 4005
 	ClientUnProcessableEntity     = 4006
+	ClientErrorPayloadTooLarge    = 4007
+	ClientErrorUnsupportedType    = 4008
+	ClientErrorQuotaExceeded      = 4009
+	ClientErrorGone               = 4010
 
 	// General Server Errors
 	ServerErrorInternal           = 5000
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,6 +34,11 @@ func Migrate(database DatabaseInterface) {
 		}
 	}
 
+	// apply in version order, a plain name sort would put V0.10 before V0.2
+	sort.SliceStable(files, func(i, j int) bool {
+		return compareMigrationVersions(files[i].Name(), files[j].Name()) < 0
+	})
+
 	// create migrations table if not exists
 	if err := database.Connection().AutoMigrate(&MigrationRecord{}); err != nil {
 		fmt.Println("Failed to create migrations_record table:", err)
@@ -97,3 +104,32 @@ func Migrate(database DatabaseInterface) {
 	fmt.Println("All migrations have been applied.")
 
 }
+
+// compareMigrationVersions orders migration files such as V0.10__name.sql by their numeric version
+func compareMigrationVersions(a string, b string) int {
+	partsA, partsB := migrationVersion(a), migrationVersion(b)
+
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if partsA[i] != partsB[i] {
+			return partsA[i] - partsB[i]
+		}
+	}
+
+	if len(partsA) != len(partsB) {
+		return len(partsA) - len(partsB)
+	}
+
+	return strings.Compare(a, b)
+}
+
+func migrationVersion(filename string) []int {
+	version, _, _ := strings.Cut(strings.TrimPrefix(filename, "V"), "__")
+
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+
+	return parts
+}
@@ -0,0 +1,336 @@
+package helper
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Encrypted objects start with a header holding the format version and a random nonce prefix, followed
+// by the content sealed with AES-256-GCM in segments of EncryptionSegmentSize. A segment's nonce is the
+// prefix, its number and a flag marking the last one, so segments can't be reordered, dropped or
+// appended, and a range can be decrypted without reading the object from its start.
+const (
+	EncryptionKeySize     = 32
+	EncryptionSegmentSize = 64 * 1024
+	EncryptionHeaderSize  = 8
+)
+
+const (
+	encryptionVersion    = 1
+	encryptionTagSize    = 16
+	encryptedSegmentSize = EncryptionSegmentSize + encryptionTagSize
+)
+
+var (
+	ErrInvalidEncryptionKey = errors.New("encryption keys must be 32 bytes")
+	ErrDecryptionFailed     = errors.New("content could not be decrypted")
+	errTooManySegments      = errors.New("content is too large to be encrypted")
+)
+
+// NewEncryptionKey returns a random AES-256 key
+func NewEncryptionKey() ([]byte, error) {
+	key := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// WrapKey seals key with the key encryption key kek, bound to context so it can't be unwrapped for
+// anything else. The result is a random nonce followed by the sealed key.
+func WrapKey(kek []byte, key []byte, context []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, key, context), nil
+}
+
+// UnwrapKey opens a key sealed by WrapKey with the same kek and context
+func UnwrapKey(kek []byte, wrapped []byte, context []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], context)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return key, nil
+}
+
+// EncryptedSize is the size of the encrypted object holding size bytes of content
+func EncryptedSize(size int64) int64 {
+	return EncryptionHeaderSize + size + segmentCount(size)*encryptionTagSize
+}
+
+// DecryptedSize is the size of the content held by an encrypted object of size bytes
+func DecryptedSize(size int64) int64 {
+	body := size - EncryptionHeaderSize
+	segments := (body + encryptedSegmentSize - 1) / encryptedSegmentSize
+
+	if segments < 1 {
+		return 0
+	}
+
+	return body - segments*encryptionTagSize
+}
+
+// EncryptedRange returns the inclusive range of an encrypted object holding size bytes of content that
+// covers content bytes start to end. It includes the header when the range starts in the first segment.
+func EncryptedRange(size int64, start int64, end int64) (int64, int64) {
+	first, last := segmentSpan(start, end)
+
+	from := EncryptionHeaderSize + first*encryptedSegmentSize
+	if first == 0 {
+		from = 0
+	}
+
+	to := min(EncryptionHeaderSize+(last+1)*encryptedSegmentSize, EncryptedSize(size)) - 1
+
+	return from, to
+}
+
+func segmentCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+
+	return (size + EncryptionSegmentSize - 1) / EncryptionSegmentSize
+}
+
+// segmentSpan returns the first and last segment holding content bytes start to end
+func segmentSpan(start int64, end int64) (int64, int64) {
+	first := start / EncryptionSegmentSize
+	if end < start {
+		return first, first
+	}
+
+	return first, end / EncryptionSegmentSize
+}
+
+func segmentNonce(prefix []byte, segment uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:11], segment)
+
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+type encryptingReader struct {
+	source  *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	segment uint32
+	plain   []byte
+	sealed  []byte
+	out     []byte
+	done    bool
+	err     error
+}
+
+// NewEncryptingReader encrypts content with key as it is read, yielding the whole encrypted object
+func NewEncryptingReader(content io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, EncryptionHeaderSize)
+	header[0] = encryptionVersion
+	if _, err := rand.Read(header[1:]); err != nil {
+		return nil, err
+	}
+
+	return &encryptingReader{
+		source: bufio.NewReaderSize(content, EncryptionSegmentSize),
+		aead:   aead,
+		prefix: header[1:],
+		plain:  make([]byte, EncryptionSegmentSize),
+		sealed: make([]byte, 0, encryptedSegmentSize),
+		out:    header,
+	}, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.done {
+			return 0, io.EOF
+		}
+
+		r.err = r.seal()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+// seal encrypts the next segment, a segment is only known to be the last once nothing follows it
+func (r *encryptingReader) seal() error {
+	n, err := io.ReadFull(r.source, r.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last := n < len(r.plain)
+	if !last {
+		if _, err := r.source.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if !last && r.segment == math.MaxUint32 {
+		return errTooManySegments
+	}
+
+	r.out = r.aead.Seal(r.sealed[:0], segmentNonce(r.prefix, r.segment, last), r.plain[:n], nil)
+	r.segment++
+	r.done = last
+
+	return nil
+}
+
+type decryptingReader struct {
+	source  io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	size    int64
+	segment int64
+	last    int64
+	start   int64
+	end     int64
+	sealed  []byte
+	out     []byte
+	err     error
+}
+
+// NewDecryptingReader returns content bytes start to end of an encrypted object holding size bytes of
+// content. encrypted must yield the object from the offset EncryptedRange returned for the same bytes,
+// header is the object's header and only used when that offset is past it.
+func NewDecryptingReader(encrypted io.Reader, key []byte, header []byte, size int64, start int64, end int64) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := segmentSpan(start, end)
+
+	if first == 0 {
+		header = make([]byte, EncryptionHeaderSize)
+		if _, err := io.ReadFull(encrypted, header); err != nil {
+			return nil, ErrDecryptionFailed
+		}
+	}
+
+	if len(header) != EncryptionHeaderSize || header[0] != encryptionVersion {
+		return nil, ErrDecryptionFailed
+	}
+
+	return &decryptingReader{
+		source:  encrypted,
+		aead:    aead,
+		prefix:  header[1:],
+		size:    size,
+		segment: first,
+		last:    last,
+		start:   start,
+		end:     end,
+		sealed:  make([]byte, encryptedSegmentSize),
+	}, nil
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.segment > r.last {
+			return 0, io.EOF
+		}
+
+		r.err = r.open()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+// open decrypts the next segment and keeps the part of it that was asked for
+func (r *decryptingReader) open() error {
+	offset := r.segment * EncryptionSegmentSize
+	length := min(int64(EncryptionSegmentSize), r.size-offset)
+	final := r.segment == segmentCount(r.size)-1
+
+	if length < 0 || r.segment > math.MaxUint32 {
+		return ErrDecryptionFailed
+	}
+
+	sealed := r.sealed[:length+encryptionTagSize]
+	if _, err := io.ReadFull(r.source, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrDecryptionFailed
+		}
+
+		return err
+	}
+
+	plain, err := r.aead.Open(sealed[:0], segmentNonce(r.prefix, uint32(r.segment), final), sealed, nil)
+	if err != nil {
+		return ErrDecryptionFailed
+	}
+
+	from := max(r.start-offset, 0)
+	to := min(r.end-offset+1, int64(len(plain)))
+
+	r.out = plain[min(from, to):to]
+	r.segment++
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrRangeNotSatisfiable = errors.New("requested range not satisfiable")
+
+// ParseRange resolves a single "bytes=" Range header against an object of the given size and returns
+// the inclusive start and end offsets. ok is false when the header should be ignored and the whole
+// object served, which includes multi-range requests.
+func ParseRange(header string, size int64) (start int64, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// suffix range, the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrRangeNotSatisfiable
+		}
+
+		if n > size {
+			n = size
+		}
+
+		return size - n, size - 1, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, ErrRangeNotSatisfiable
+	}
+
+	return start, end, true, nil
+}
+
+// MatchETag reports whether etag is listed in an If-None-Match or If-Range header, comparing weakly
+func MatchETag(header string, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
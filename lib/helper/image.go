@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("image format is not supported")
+	ErrImageTooLarge    = errors.New("image is too large to transform")
+)
+
+var (
+	ImageFitContain = "contain"
+	ImageFitCover   = "cover"
+	ImageFitFill    = "fill"
+)
+
+var (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+	ImageFormatGIF  = "gif"
+)
+
+// ImageContentTypes maps the output formats to the content type they are served with
+var ImageContentTypes = map[string]string{
+	ImageFormatJPEG: "image/jpeg",
+	ImageFormatPNG:  "image/png",
+	ImageFormatGIF:  "image/gif",
+}
+
+// ImageTransform describes a resize and re-encode. A zero width or height is derived from the aspect ratio.
+type ImageTransform struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// TransformImage decodes a JPEG, PNG, GIF or WebP image, resizes it and encodes it in the requested format.
+// Images with more than maxPixels pixels are refused before they are decoded.
+func TransformImage(src io.Reader, transform ImageTransform, maxPixels int) ([]byte, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	img = resizeImage(img, transform)
+
+	var out bytes.Buffer
+
+	switch transform.Format {
+	case ImageFormatJPEG:
+		err = jpeg.Encode(&out, flatten(img), &jpeg.Options{Quality: transform.Quality})
+	case ImageFormatPNG:
+		err = png.Encode(&out, img)
+	case ImageFormatGIF:
+		err = gif.Encode(&out, img, nil)
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func resizeImage(img image.Image, transform ImageTransform) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	width, height := transform.Width, transform.Height
+	if width == 0 && height == 0 {
+		return img
+	}
+
+	// a single dimension always keeps the aspect ratio
+	if width == 0 {
+		width = max(1, srcWidth*height/srcHeight)
+	} else if height == 0 {
+		height = max(1, srcHeight*width/srcWidth)
+	} else if transform.Fit == ImageFitContain {
+		if srcWidth*height > srcHeight*width {
+			height = max(1, srcHeight*width/srcWidth)
+		} else {
+			width = max(1, srcWidth*height/srcHeight)
+		}
+	}
+
+	crop := bounds
+	if transform.Fit == ImageFitCover && transform.Width > 0 && transform.Height > 0 {
+		// take the centered part of the source with the target aspect ratio
+		if srcWidth*height > srcHeight*width {
+			cropWidth := srcHeight * width / height
+			crop.Min.X += (srcWidth - cropWidth) / 2
+			crop.Max.X = crop.Min.X + cropWidth
+		} else {
+			cropHeight := srcWidth * height / width
+			crop.Min.Y += (srcHeight - cropHeight) / 2
+			crop.Max.Y = crop.Min.Y + cropHeight
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+
+	return dst
+}
+
+// flatten composes an image onto white, JPEG has no transparency
+func flatten(img image.Image) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return dst
+}
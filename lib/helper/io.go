@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrBodyTooLarge = errors.New("request body is too large")
+
+// CountingReader counts the bytes that have been read through it. Err keeps the first read error
+// other than io.EOF, storage clients tend to wrap it beyond recognition.
+type CountingReader struct {
+	Reader io.Reader
+	Count  int64
+	Err    error
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.Count += int64(n)
+
+	if err != nil && err != io.EOF && r.Err == nil {
+		r.Err = err
+	}
+
+	return n, err
+}
+
+// TruncatingReader ends at the first read error of Reader as if the content ended there and keeps the
+// error in Err, so what was received of a body that broke off can still be stored
+type TruncatingReader struct {
+	Reader io.Reader
+	Err    error
+}
+
+func (r *TruncatingReader) Read(p []byte) (int, error) {
+	if r.Err != nil {
+		return 0, io.EOF
+	}
+
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.Err = err
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+// limitedReader behaves like io.LimitReader but fails instead of silently truncating
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+// NewLimitedReader returns a reader that fails with ErrBodyTooLarge once more than limit bytes are read
+func NewLimitedReader(reader io.Reader, limit int64) io.Reader {
+	return NewLimitedReaderError(reader, limit, ErrBodyTooLarge)
+}
+
+// NewLimitedReaderError returns a reader that fails with err once more than limit bytes are read
+func NewLimitedReaderError(reader io.Reader, limit int64, err error) io.Reader {
+	return &limitedReader{reader: reader, remaining: max(limit, 0), err: err}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.reader.Read(p)
+	if int64(n) > l.remaining {
+		l.remaining = -1
+		return 0, l.err
+	}
+
+	l.remaining -= int64(n)
+
+	return n, err
+}
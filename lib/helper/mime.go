@@ -0,0 +1,215 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SniffLength is how many leading bytes content type detection looks at
+const SniffLength = 512
+
+const (
+	ContentTypeUnknown    = "application/octet-stream"
+	ContentTypeText       = "text/plain"
+	ContentTypeHTML       = "text/html"
+	ContentTypeXML        = "text/xml"
+	ContentTypeZip        = "application/zip"
+	ContentTypeWindowsExe = "application/x-msdownload"
+	ContentTypeELF        = "application/x-executable"
+	ContentTypeMachO      = "application/x-mach-binary"
+	ContentTypeScript     = "text/x-shellscript"
+)
+
+// executableSignatures are binaries http.DetectContentType reports as unknown
+var executableSignatures = []struct {
+	magic       []byte
+	contentType string
+}{
+	{[]byte("MZ"), ContentTypeWindowsExe},
+	{[]byte("\x7fELF"), ContentTypeELF},
+	{[]byte("\xfe\xed\xfa\xce"), ContentTypeMachO},
+	{[]byte("\xfe\xed\xfa\xcf"), ContentTypeMachO},
+	{[]byte("\xce\xfa\xed\xfe"), ContentTypeMachO},
+	{[]byte("\xcf\xfa\xed\xfe"), ContentTypeMachO},
+	{[]byte("#!"), ContentTypeScript},
+}
+
+// activeContent matches markup that runs script when a browser renders it
+var activeContent = regexp.MustCompile(`(?i)<script|javascript:|\son[a-z]+\s*=`)
+
+// activeContentOverlap is how much of a chunk is kept so a match split across reads is still found
+const activeContentOverlap = 256
+
+// markupTypes are rendered by browsers as documents that can run script
+var markupTypes = map[string]bool{
+	ContentTypeHTML:         true,
+	ContentTypeXML:          true,
+	"application/xhtml+xml": true,
+	"application/xml":       true,
+	"image/svg+xml":         true,
+}
+
+// preferredExtensions are used for keys when the uploaded name has no usable extension
+var preferredExtensions = map[string]string{
+	"image/jpeg":       "jpg",
+	"image/png":        "png",
+	"image/gif":        "gif",
+	"image/webp":       "webp",
+	"image/svg+xml":    "svg",
+	"application/pdf":  "pdf",
+	"application/zip":  "zip",
+	"application/json": "json",
+	"text/plain":       "txt",
+	"text/html":        "html",
+	"text/csv":         "csv",
+	"audio/mpeg":       "mp3",
+	"video/mp4":        "mp4",
+	"video/webm":       "webm",
+}
+
+var extensionPattern = regexp.MustCompile(`^[a-z0-9]{1,10}$`)
+
+// PeekHead returns the first SniffLength bytes of body along with a reader that still yields all of it
+func PeekHead(body io.Reader) ([]byte, io.Reader, error) {
+	reader := bufio.NewReaderSize(body, SniffLength)
+
+	head, err := reader.Peek(SniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, err
+	}
+
+	return head, reader, nil
+}
+
+// SniffContentType detects the type of content from its leading bytes. scripted is set for markup
+// that carries script, which is harmless as a download but dangerous when served inline.
+func SniffContentType(head []byte) (contentType string, scripted bool) {
+	for _, signature := range executableSignatures {
+		if bytes.HasPrefix(head, signature.magic) {
+			return signature.contentType, false
+		}
+	}
+
+	contentType = BaseContentType(http.DetectContentType(head))
+
+	switch contentType {
+	case ContentTypeHTML, ContentTypeXML, ContentTypeText:
+		scripted = activeContent.Match(head)
+	}
+
+	return contentType, scripted
+}
+
+// IsMarkup reports whether content of the type can run script when a browser renders it
+func IsMarkup(contentType string) bool {
+	return markupTypes[BaseContentType(contentType)]
+}
+
+// ScriptDetector passes a body through while looking for script anywhere in it, not only in the head
+type ScriptDetector struct {
+	reader   io.Reader
+	tail     []byte
+	scripted bool
+}
+
+func NewScriptDetector(reader io.Reader) *ScriptDetector {
+	return &ScriptDetector{reader: reader}
+}
+
+func (d *ScriptDetector) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+
+	if n > 0 && !d.scripted {
+		chunk := append(d.tail, p[:n]...)
+		d.scripted = activeContent.Match(chunk)
+		d.tail = append(d.tail[:0], chunk[max(len(chunk)-activeContentOverlap, 0):]...)
+	}
+
+	return n, err
+}
+
+// Scripted reports whether the bytes read so far carry script
+func (d *ScriptDetector) Scripted() bool {
+	return d.scripted
+}
+
+// BaseContentType strips parameters from a content type and lowercases it
+func BaseContentType(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// ContentTypeCompatible reports whether declared is a plausible type for content detected as detected.
+// Detection only tells families apart for text, XML and zip containers, so any member of those passes.
+func ContentTypeCompatible(declared string, detected string) bool {
+	declared, detected = BaseContentType(declared), BaseContentType(detected)
+
+	if declared == detected || detected == ContentTypeUnknown {
+		return true
+	}
+
+	switch detected {
+	case ContentTypeText, ContentTypeScript:
+		return strings.HasPrefix(declared, "text/") ||
+			strings.HasSuffix(declared, "+json") ||
+			strings.HasSuffix(declared, "+xml") ||
+			strings.Contains(declared, "json") ||
+			strings.Contains(declared, "javascript") ||
+			strings.Contains(declared, "yaml") ||
+			strings.Contains(declared, "xml")
+	case ContentTypeXML:
+		return strings.Contains(declared, "xml")
+	case ContentTypeZip:
+		return strings.HasSuffix(declared, "+zip") ||
+			strings.Contains(declared, "openxmlformats") ||
+			strings.Contains(declared, "opendocument") ||
+			declared == "application/java-archive" ||
+			declared == "application/x-zip-compressed"
+	}
+
+	return false
+}
+
+// MatchContentType matches a content type against a pattern such as image/png, image/* or */*
+func MatchContentType(pattern string, contentType string) bool {
+	pattern, contentType = BaseContentType(pattern), BaseContentType(contentType)
+
+	if pattern == "*/*" || pattern == contentType {
+		return true
+	}
+
+	family, found := strings.CutSuffix(pattern, "/*")
+
+	return found && strings.HasPrefix(contentType, family+"/")
+}
+
+// FileExtension picks the extension for a stored file. The uploaded name's extension is kept when it
+// agrees with the content type, otherwise one is derived from the type. Empty when none fits.
+func FileExtension(name string, contentType string) string {
+	contentType = BaseContentType(contentType)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+
+	if extensionPattern.MatchString(ext) {
+		byExt := BaseContentType(mime.TypeByExtension("." + ext))
+		if contentType == "" || byExt == "" || byExt == contentType {
+			return ext
+		}
+	}
+
+	if ext, ok := preferredExtensions[contentType]; ok {
+		return ext
+	}
+
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return strings.TrimPrefix(exts[0], ".")
+	}
+
+	return ""
+}
@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the wildcards of a LIKE pattern so value only matches itself
+func EscapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// Highlight HTML-escapes text and wraps every case-insensitive occurrence of the terms in <mark> tags.
+// It returns an empty string when none of the terms occur.
+func Highlight(text string, terms []string) string {
+	quoted := []string{}
+	for _, term := range terms {
+		if term != "" {
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+
+	if len(quoted) == 0 {
+		return ""
+	}
+
+	// longer terms first, so a term that contains another one is marked whole
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+
+	matches := regexp.MustCompile("(?i)"+strings.Join(quoted, "|")).FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+
+	var highlighted strings.Builder
+
+	last := 0
+	for _, match := range matches {
+		highlighted.WriteString(html.EscapeString(text[last:match[0]]))
+		highlighted.WriteString("<mark>")
+		highlighted.WriteString(html.EscapeString(text[match[0]:match[1]]))
+		highlighted.WriteString("</mark>")
+
+		last = match[1]
+	}
+
+	highlighted.WriteString(html.EscapeString(text[last:]))
+
+	return highlighted.String()
+}
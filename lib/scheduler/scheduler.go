@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a unit of background work run by the scheduler
+type Job func(ctx context.Context) error
+
+// Every runs job in the background at the given interval for the lifetime of the process
+func Every(name string, interval time.Duration, job Job) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := job(context.Background()); err != nil {
+				log.Printf("scheduler: %s failed: %s", name, err)
+			}
+		}
+	}()
+}
@@ -13,26 +13,41 @@ import (
 	"github.com/shordem/api.thryvo/lib/constants"
 	"github.com/shordem/api.thryvo/lib/database"
 	"github.com/shordem/api.thryvo/lib/seed"
+	"github.com/shordem/api.thryvo/middleware"
 	"github.com/shordem/api.thryvo/router"
 )
 
 func main() {
+	// Bodies above BodyLimit are streamed rather than buffered, so uploads can be piped
+	// straight to storage. Upload routes apply the limit of the user's plan instead.
 	app := fiber.New(fiber.Config{
-		AppName:   "Thryvo v0.0.1",
-		BodyLimit: 10 * 1024 * 1024,
+		AppName:                      "Thryvo v0.0.1",
+		BodyLimit:                    constants.MaxBufferedBodySize,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	app.Use(logger.New(logger.Config{}))
 	app.Use(recover.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-KEY",
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-API-KEY, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Range, If-Range, If-None-Match, If-Modified-Since, X-Share-Password",
+		ExposeHeaders: "Location, Tus-Resumable, Tus-Version, Tus-Extension, Upload-Length, Upload-Offset, X-File-Id, X-File-Key, Content-Range, Content-Disposition, Accept-Ranges, ETag, Last-Modified",
 	}))
 	app.Use(limiter.New(limiter.Config{
 		Max:               1000,
 		Expiration:        60 * time.Second,
 		LimiterMiddleware: limiter.FixedWindow{},
 	}))
+	app.Use(middleware.BodyLimit(
+		constants.MaxBufferedBodySize,
+		"/v1/files",
+		"/v1/file/upload",
+		"/v1/file/upload/batch",
+		"/v1/file/:id/versions",
+		"/v1/upload",
+		"/v1/upload/:id",
+	))
 
 	// Get environment variables
 	env := constants.GetEnv()
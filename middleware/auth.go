@@ -5,7 +5,9 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/shordem/api.thryvo/lib/database"
 	"github.com/shordem/api.thryvo/lib/helper"
+	user_repository "github.com/shordem/api.thryvo/repository/user"
 )
 
 func Protected() fiber.Handler {
@@ -24,3 +26,42 @@ func Protected() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// ProtectedOrAPIKey authenticates with the X-API-KEY header when it is sent, otherwise with a bearer access token
+func ProtectedOrAPIKey(db database.DatabaseInterface) fiber.Handler {
+	apiKeyMiddleware := RequireAPIKey(db)
+	authMiddleware := Protected()
+
+	return func(c *fiber.Ctx) error {
+		if c.Get("X-API-KEY") != "" {
+			return apiKeyMiddleware(c)
+		}
+
+		return authMiddleware(c)
+	}
+}
+
+// OptionalAuth identifies the caller from an API key or bearer token when one is sent, but lets
+// anonymous requests and requests with invalid credentials through without a user
+func OptionalAuth(db database.DatabaseInterface) fiber.Handler {
+	authHelper := helper.NewAuth()
+	keyRepo := user_repository.NewKeyRepository(db)
+
+	return func(c *fiber.Ctx) error {
+		if apiKey := c.Get("X-API-KEY"); apiKey != "" {
+			if key, err := keyRepo.FindUserIDByKey(apiKey); err == nil {
+				c.Locals("userId", key.UserID)
+			}
+
+			return c.Next()
+		}
+
+		if token := authHelper.ExtractBearerToken(c.Request()); token != "" {
+			if userId, err := authHelper.ExtractUserID(token, "access"); err == nil {
+				c.Locals("userId", userId)
+			}
+		}
+
+		return c.Next()
+	}
+}
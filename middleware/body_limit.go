@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/constants"
+)
+
+// multipartOverhead leaves room for boundaries and form fields on top of the file itself
+const multipartOverhead = 64 * 1024
+
+type PlanLimitChecker interface {
+	GetPlanLimits(ctx context.Context, userID uuid.UUID) (*dto.PlanLimits, error)
+}
+
+// BodyLimit rejects request bodies larger than limit. Multipart and tus bodies sent to one of the
+// upload routes are streamed instead of being buffered, so they are left to the upload limits. Routes
+// are paths such as /v1/upload/:id, where a segment starting with a colon matches any segment.
+func BodyLimit(limit int, uploadRoutes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		contentType := c.Get(fiber.HeaderContentType)
+		streamed := strings.HasPrefix(contentType, fiber.MIMEMultipartForm) || contentType == constants.TusContentType
+		if streamed && matchesRoute(uploadRoutes, c.Path()) {
+			return c.Next()
+		}
+
+		length := c.Request().Header.ContentLength()
+
+		// chunked bodies would be read into memory without knowing their size
+		if length == -1 {
+			return c.Status(fiber.StatusLengthRequired).JSON(fiber.Map{"message": "Content-Length is required"})
+		}
+
+		if length > limit {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": "Request body is too large"})
+		}
+
+		return c.Next()
+	}
+}
+
+// matchesRoute reports whether path is one of routes, ignoring case and trailing slashes like the router
+func matchesRoute(routes []string, path string) bool {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+
+	for _, route := range routes {
+		parts := strings.Split(strings.TrimSuffix(route, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		matched := true
+		for i, part := range parts {
+			if !strings.HasPrefix(part, ":") && !strings.EqualFold(part, segments[i]) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UploadLimit caps upload bodies at the max upload size of the user's plan.
+// It must run after the middleware that sets the userId local.
+func UploadLimit(planLimits PlanLimitChecker) fiber.Handler {
+	return uploadLimit(planLimits, 1)
+}
+
+// BatchUploadLimit caps batch upload bodies at maxFiles files of the max upload size of the user's plan,
+// the size of each file is checked as it is stored. It must run after the middleware that sets the userId local.
+func BatchUploadLimit(planLimits PlanLimitChecker, maxFiles int) fiber.Handler {
+	return uploadLimit(planLimits, int64(maxFiles))
+}
+
+func uploadLimit(planLimits PlanLimitChecker, files int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userId := c.Locals("userId").(uuid.UUID)
+
+		limits, err := planLimits.GetPlanLimits(c.Context(), userId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to resolve upload limit"})
+		}
+
+		limit := (limits.MaxUploadSize + multipartOverhead) * files
+
+		if length := c.Request().Header.ContentLength(); length > 0 && int64(length) > limit {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": "File exceeds the upload limit of your plan"})
+		}
+
+		c.Locals("uploadLimit", limit)
+
+		return c.Next()
+	}
+}
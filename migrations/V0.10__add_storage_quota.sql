@@ -0,0 +1,22 @@
+-- Per-plan storage quota in bytes, 0 falls back to the free tier quota
+ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS storage_quota BIGINT NOT NULL DEFAULT 0;
+
+-- Table for the bytes each user has stored, kept in step with the blobs table
+CREATE TABLE IF NOT EXISTS "storage_usages" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "bytes_used" BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_storage_usages_user_id ON storage_usages(user_id);
+
+-- Existing blobs are counted once
+INSERT INTO storage_usages (id, user_id, bytes_used)
+SELECT gen_random_uuid(), user_id, SUM(size)
+FROM blobs
+GROUP BY user_id
+ON CONFLICT (user_id) DO UPDATE SET bytes_used = EXCLUDED.bytes_used;
@@ -0,0 +1,2 @@
+-- Per-plan cap on the bytes of files in one archive download, 0 falls back to the free tier limit
+ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS max_archive_size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Trigram index for case-insensitive name search with ILIKE and similarity ranking
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_files_original_name_trgm ON files USING GIN (original_name gin_trgm_ops);
+
+-- Indexes for the type, size and date filters
+CREATE INDEX IF NOT EXISTS idx_files_user_id_mime_type ON files(user_id, mime_type);
+CREATE INDEX IF NOT EXISTS idx_files_user_id_size ON files(user_id, size);
+CREATE INDEX IF NOT EXISTS idx_files_user_id_created_at ON files(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_files_user_id_updated_at ON files(user_id, updated_at);
@@ -0,0 +1,35 @@
+-- User defined tags, names are unique per user regardless of case
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "name" VARCHAR(64) NOT NULL,
+    "color" VARCHAR(7) NOT NULL DEFAULT '',
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_name ON tags(user_id, LOWER(name));
+
+-- Tags attached to files
+CREATE TABLE IF NOT EXISTS "file_tags" (
+    "file_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    PRIMARY KEY ("file_id", "tag_id"),
+    FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("tag_id") REFERENCES "tags" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_tags_tag_id ON file_tags(tag_id);
+
+-- Tags attached to folders
+CREATE TABLE IF NOT EXISTS "folder_tags" (
+    "folder_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    PRIMARY KEY ("folder_id", "tag_id"),
+    FOREIGN KEY ("folder_id") REFERENCES "folders" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("tag_id") REFERENCES "tags" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_folder_tags_tag_id ON folder_tags(tag_id);
@@ -0,0 +1,4 @@
+-- Caller defined key-value metadata, queried by containment
+ALTER TABLE files ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_files_metadata ON files USING GIN (metadata jsonb_path_ops);
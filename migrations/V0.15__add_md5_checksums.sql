@@ -0,0 +1,4 @@
+-- Hex encoded MD5 of the content, files and versions stored before this have none
+ALTER TABLE files ADD COLUMN IF NOT EXISTS md5 VARCHAR(32);
+
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS md5 VARCHAR(32);
@@ -0,0 +1,6 @@
+-- Files can expire, the sweeper deletes them once expires_at has passed
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expiry_warning BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expiry_warned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_files_expires_at ON files(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Key encryption keys of users, wrapped by a master key from the configuration
+CREATE TABLE IF NOT EXISTS "user_keys" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "master_key_id" VARCHAR(64) NOT NULL,
+    "wrapped_key" BYTEA NOT NULL,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_keys_user_id ON user_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_keys_master_key_id ON user_keys(master_key_id);
+
+-- Data keys of encrypted objects, wrapped by the owner's key. Objects stored before stay in plaintext.
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS wrapped_key BYTEA;
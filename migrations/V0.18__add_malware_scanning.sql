@@ -0,0 +1,6 @@
+-- Content is scanned for malware after it is stored, infected content is quarantined
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS scan_status VARCHAR(16) NOT NULL DEFAULT 'pending';
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_blobs_scan_status ON blobs(scan_status) WHERE scan_status IN ('pending', 'infected');
@@ -0,0 +1,23 @@
+-- Links giving anyone holding their token access to one file or to a folder and everything below it
+CREATE TABLE IF NOT EXISTS "share_links" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "token" VARCHAR(64) NOT NULL,
+    "file_id" UUID,
+    "folder_id" UUID,
+    "password_hash" VARCHAR(255),
+    "expires_at" TIMESTAMP,
+    "max_downloads" BIGINT,
+    "downloads" BIGINT NOT NULL DEFAULT 0,
+    "revoked_at" TIMESTAMP,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("folder_id") REFERENCES "folders" ("id") ON DELETE CASCADE,
+    CHECK (("file_id" IS NULL) <> ("folder_id" IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_share_links_token ON share_links(token);
+CREATE INDEX IF NOT EXISTS idx_share_links_user_id ON share_links(user_id);
@@ -0,0 +1,24 @@
+-- Roles other users are given on a file, or on a folder and everything below it
+CREATE TABLE IF NOT EXISTS "permissions" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "owner_id" UUID NOT NULL,
+    "user_id" UUID NOT NULL,
+    "file_id" UUID,
+    "folder_id" UUID,
+    "role" VARCHAR(16) NOT NULL,
+    "granted_by" UUID,
+    FOREIGN KEY ("owner_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("folder_id") REFERENCES "folders" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("granted_by") REFERENCES "users" ("id") ON DELETE SET NULL,
+    CHECK (("file_id" IS NULL) <> ("folder_id" IS NULL)),
+    CHECK ("role" IN ('viewer', 'editor', 'owner'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_user_id_file_id ON permissions(user_id, file_id) WHERE file_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_user_id_folder_id ON permissions(user_id, folder_id) WHERE folder_id IS NOT NULL AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_permissions_owner_id_user_id ON permissions(owner_id, user_id);
@@ -0,0 +1,4 @@
+-- Who a direct upload's file will belong to, the folder's owner when it goes into a folder shared with the uploader
+ALTER TABLE "direct_uploads" ADD COLUMN IF NOT EXISTS "owner_id" UUID REFERENCES "users" ("id") ON DELETE CASCADE;
+UPDATE "direct_uploads" SET "owner_id" = "user_id" WHERE "owner_id" IS NULL;
+ALTER TABLE "direct_uploads" ALTER COLUMN "owner_id" SET NOT NULL;
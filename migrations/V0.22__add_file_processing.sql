@@ -0,0 +1,4 @@
+-- Direct uploads are hashed, encrypted and scanned for script in the background, their files are pending until then
+ALTER TABLE files ADD COLUMN IF NOT EXISTS processing_status VARCHAR(16) NOT NULL DEFAULT 'ready';
+
+CREATE INDEX IF NOT EXISTS idx_files_processing_status ON files(processing_status) WHERE processing_status = 'pending';
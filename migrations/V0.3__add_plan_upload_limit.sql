@@ -0,0 +1,2 @@
+-- Per-plan upload size limit in bytes, 0 falls back to the free tier limit
+ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS max_upload_size BIGINT NOT NULL DEFAULT 0;
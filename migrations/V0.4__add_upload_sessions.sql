@@ -0,0 +1,35 @@
+-- Table for storing resumable upload sessions
+CREATE TABLE IF NOT EXISTS "upload_sessions" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "folder_id" UUID NULL,
+    "original_name" VARCHAR NOT NULL,
+    "mime_type" VARCHAR NOT NULL,
+    "upload_length" BIGINT NOT NULL,
+    "upload_offset" BIGINT NOT NULL DEFAULT 0,
+    "file_id" UUID NULL,
+    "expires_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("folder_id") REFERENCES "folders" ("id") ON DELETE SET NULL,
+    FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON DELETE SET NULL
+);
+
+-- Table for storing the chunks received for an upload session
+CREATE TABLE IF NOT EXISTS "upload_chunks" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "upload_session_id" UUID NOT NULL,
+    "start_offset" BIGINT NOT NULL,
+    "size" BIGINT NOT NULL,
+    "path" VARCHAR NOT NULL,
+    FOREIGN KEY ("upload_session_id") REFERENCES "upload_sessions" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at) WHERE file_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_upload_chunks_session_offset ON upload_chunks(upload_session_id, start_offset);
@@ -0,0 +1,18 @@
+-- Table for storing presigned uploads that have not been finalized yet
+CREATE TABLE IF NOT EXISTS "direct_uploads" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "folder_id" UUID NULL,
+    "key" VARCHAR NOT NULL,
+    "original_name" VARCHAR NOT NULL,
+    "mime_type" VARCHAR NOT NULL,
+    "expires_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("folder_id") REFERENCES "folders" ("id") ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_direct_uploads_user_id ON direct_uploads(user_id);
+CREATE INDEX IF NOT EXISTS idx_direct_uploads_expires_at ON direct_uploads(expires_at);
@@ -0,0 +1,3 @@
+-- Visibility chosen for the file an upload turns into
+ALTER TABLE "upload_sessions" ADD COLUMN IF NOT EXISTS "visibility" VARCHAR NOT NULL DEFAULT 'public';
+ALTER TABLE "direct_uploads" ADD COLUMN IF NOT EXISTS "visibility" VARCHAR NOT NULL DEFAULT 'public';
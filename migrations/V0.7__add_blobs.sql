@@ -0,0 +1,21 @@
+-- Table for storing deduplicated file contents, one row per distinct content per user
+CREATE TABLE IF NOT EXISTS "blobs" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NOT NULL,
+    "hash" VARCHAR(64) NOT NULL,
+    "path" VARCHAR NOT NULL,
+    "size" BIGINT NOT NULL,
+    "ref_count" BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blobs_user_id_hash ON blobs(user_id, hash);
+
+-- Files uploaded before deduplication keep a NULL blob and are stored under their own key
+ALTER TABLE "files" ADD COLUMN IF NOT EXISTS "hash" VARCHAR(64) NULL;
+ALTER TABLE "files" ADD COLUMN IF NOT EXISTS "blob_id" UUID NULL REFERENCES "blobs" ("id") ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_files_blob_id ON files(blob_id);
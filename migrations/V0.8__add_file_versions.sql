@@ -0,0 +1,39 @@
+-- Per-plan number of versions kept for each file, 0 falls back to the free tier limit
+ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS max_file_versions INTEGER NOT NULL DEFAULT 0;
+
+-- Table for storing the content history of files, the highest number is the current version
+CREATE TABLE IF NOT EXISTS "file_versions" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "file_id" UUID NOT NULL,
+    "number" INTEGER NOT NULL,
+    "blob_id" UUID NULL,
+    "size" BIGINT NOT NULL,
+    "hash" VARCHAR(64) NULL,
+    "mime_type" VARCHAR NOT NULL,
+    "uploaded_by" UUID NULL,
+    FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("blob_id") REFERENCES "blobs" ("id") ON DELETE SET NULL,
+    FOREIGN KEY ("uploaded_by") REFERENCES "users" ("id") ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_versions_file_id_number ON file_versions(file_id, number);
+
+ALTER TABLE "files" ADD COLUMN IF NOT EXISTS "version" INTEGER NOT NULL DEFAULT 1;
+
+-- Files from before deduplication get a blob of their own so that every version holds a blob reference
+INSERT INTO blobs (id, created_at, updated_at, user_id, hash, path, size, ref_count)
+SELECT id, created_at, updated_at, user_id, 'legacy-' || id, user_id || '/' || key, size, 1
+FROM files
+WHERE blob_id IS NULL
+ON CONFLICT DO NOTHING;
+
+UPDATE files SET blob_id = id WHERE blob_id IS NULL;
+
+-- Every existing file becomes version 1 of itself, taking over the blob reference the file held
+INSERT INTO file_versions (id, created_at, updated_at, file_id, number, blob_id, size, hash, mime_type, uploaded_by)
+SELECT id, created_at, created_at, id, 1, blob_id, size, hash, mime_type, user_id
+FROM files
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,24 @@
+-- Content type rules, global rules (no user) are admin managed deny rules and user rules are allow lists
+CREATE TABLE IF NOT EXISTS "content_type_rules" (
+    "id" UUID PRIMARY KEY,
+    "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP,
+    "user_id" UUID NULL,
+    "pattern" VARCHAR(255) NOT NULL,
+    "script_only" BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_type_rules_user_id ON content_type_rules(user_id);
+
+-- Executables and markup carrying script are blocked out of the box
+INSERT INTO content_type_rules (id, pattern, script_only) VALUES
+    (gen_random_uuid(), 'application/x-msdownload', FALSE),
+    (gen_random_uuid(), 'application/x-executable', FALSE),
+    (gen_random_uuid(), 'application/x-mach-binary', FALSE),
+    (gen_random_uuid(), 'application/x-msi', FALSE),
+    (gen_random_uuid(), 'text/html', TRUE),
+    (gen_random_uuid(), 'application/xhtml+xml', TRUE),
+    (gen_random_uuid(), 'image/svg+xml', TRUE),
+    (gen_random_uuid(), 'text/xml', TRUE);
@@ -1,6 +1,11 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 
 	"github.com/shordem/api.thryvo/lib/database"
@@ -16,8 +21,67 @@ type File struct {
 	MimeType     string     `json:"type"`
 	Size         int64      `json:"size"`
 	Visibility   string     `json:"visibility"`
+	Hash         *string    `json:"hash"`
+	MD5          *string    `json:"md5"`
+	BlobID       *uuid.UUID `json:"blob_id"`
+	Version      int        `json:"version"`
+	Metadata     Metadata   `json:"metadata"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	// ExpiryWarning asks for an email to the owner shortly before the file expires
+	ExpiryWarning  bool       `json:"expiry_warning"`
+	ExpiryWarnedAt *time.Time `json:"expiry_warned_at"`
+	// ProcessingStatus is pending while content put in storage by the client still has to be copied to a
+	// key of our own, until then the file has no blob and is served from its key
+	ProcessingStatus string `json:"processing_status" gorm:"default:ready"`
 
-	Folder *Folder `json:"folder"`
+	Folder   *Folder       `json:"folder"`
+	Blob     *Blob         `json:"blob"`
+	Versions []FileVersion `json:"versions"`
+	Tags     []Tag         `json:"tags" gorm:"many2many:file_tags"`
+}
+
+// FileVersion is one upload of a file's content. The File row mirrors its current (highest numbered) version
+// and every version holds a reference on its blob.
+type FileVersion struct {
+	database.BaseModel
+
+	FileID     uuid.UUID  `json:"file_id"`
+	Number     int        `json:"number"`
+	BlobID     *uuid.UUID `json:"blob_id"`
+	Size       int64      `json:"size"`
+	Hash       *string    `json:"hash"`
+	MD5        *string    `json:"md5"`
+	MimeType   string     `json:"mime_type"`
+	UploadedBy *uuid.UUID `json:"uploaded_by"`
+
+	Blob *Blob `json:"blob"`
+}
+
+// Blob is a stored object shared by every file of a user with the same SHA-256 content hash
+type Blob struct {
+	database.BaseModel
+
+	UserID   uuid.UUID `json:"user_id"`
+	Hash     string    `json:"hash"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	RefCount int64     `json:"ref_count"`
+	// WrappedKey is the key the object is encrypted with, wrapped by the user's key. Nil for plaintext objects.
+	WrappedKey []byte `json:"-"`
+	// ScanStatus is where the content is in malware scanning, ScanSignature names what an infected one holds
+	ScanStatus    string     `json:"scan_status"`
+	ScanSignature string     `json:"scan_signature"`
+	ScannedAt     *time.Time `json:"scanned_at"`
+}
+
+// UserKey is a user's key encryption key, wrapped by the master key MasterKeyID names. Rotating the master
+// key only rewraps these, the data keys of the user's objects are wrapped by the unwrapped user key.
+type UserKey struct {
+	database.BaseModel
+
+	UserID      uuid.UUID `json:"user_id"`
+	MasterKeyID string    `json:"master_key_id"`
+	WrappedKey  []byte    `json:"-"`
 }
 
 type Folder struct {
@@ -28,4 +92,135 @@ type Folder struct {
 	Name     string     `json:"name"`
 
 	Parent *Folder `json:"parent"`
+	Tags   []Tag   `json:"tags" gorm:"many2many:folder_tags"`
+}
+
+// UploadSession tracks a resumable (tus) upload until its bytes are assembled into a File
+type UploadSession struct {
+	database.BaseModel
+
+	UserID       uuid.UUID  `json:"user_id"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	OriginalName string     `json:"original_name"`
+	MimeType     string     `json:"mime_type"`
+	Visibility   string     `json:"visibility"`
+	UploadLength int64      `json:"upload_length"`
+	UploadOffset int64      `json:"upload_offset"`
+	FileID       *uuid.UUID `json:"file_id"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// UploadChunk is a stored piece of an upload session starting at StartOffset
+type UploadChunk struct {
+	database.BaseModel
+
+	UploadSessionID uuid.UUID `json:"upload_session_id"`
+	StartOffset     int64     `json:"start_offset"`
+	Size            int64     `json:"size"`
+	Path            string    `json:"path"`
+}
+
+// DirectUpload is an object the client was allowed to PUT straight to storage, it becomes a File once finalized
+type DirectUpload struct {
+	database.BaseModel
+
+	UserID uuid.UUID `json:"user_id"`
+	// OwnerID is who the file will belong to and whose path the object is stored under. It is the folder's
+	// owner when the upload goes into a folder shared with the user.
+	OwnerID      uuid.UUID  `json:"owner_id"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	Key          string     `json:"key"`
+	OriginalName string     `json:"original_name"`
+	MimeType     string     `json:"mime_type"`
+	Visibility   string     `json:"visibility"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// ContentTypeRule is a content type pattern such as image/* or application/pdf. Rules without a user
+// are set by admins and block the type for everyone, a user's rules are the only types they accept.
+type ContentTypeRule struct {
+	database.BaseModel
+
+	UserID  *uuid.UUID `json:"user_id"`
+	Pattern string     `json:"pattern"`
+	// ScriptOnly limits a blocking rule to markup that carries script
+	ScriptOnly bool `json:"script_only"`
+}
+
+// StorageUsage is the number of bytes a user's blobs take up in storage
+type StorageUsage struct {
+	database.BaseModel
+
+	UserID    uuid.UUID `json:"user_id"`
+	BytesUsed int64     `json:"bytes_used"`
+}
+
+// Tag is a user defined label that can be attached to any number of the user's files and folders
+type Tag struct {
+	database.BaseModel
+
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Color  string    `json:"color"`
+}
+
+// ShareLink gives anyone holding its token access to a file, or to a folder and everything below it.
+// Exactly one of FileID and FolderID is set.
+type ShareLink struct {
+	database.BaseModel
+
+	UserID       uuid.UUID  `json:"user_id"`
+	Token        string     `json:"token"`
+	FileID       *uuid.UUID `json:"file_id"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	PasswordHash *string    `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads *int64     `json:"max_downloads"`
+	Downloads    int64      `json:"downloads"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// Permission gives another user a role on a file, or on a folder and everything below it. Exactly one
+// of FileID and FolderID is set.
+type Permission struct {
+	database.BaseModel
+
+	OwnerID   uuid.UUID  `json:"owner_id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	FileID    *uuid.UUID `json:"file_id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Role      string     `json:"role"`
+	GrantedBy *uuid.UUID `json:"granted_by"`
+
+	Owner  *User   `json:"owner" gorm:"foreignKey:OwnerID"`
+	User   *User   `json:"user"`
+	File   *File   `json:"file"`
+	Folder *Folder `json:"folder"`
+}
+
+// Metadata is a caller defined string map stored as a JSONB object
+type Metadata map[string]string
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+
+	value, err := json.Marshal(m)
+
+	return string(value), err
+}
+
+func (m *Metadata) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		*m = Metadata{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, m)
+	case string:
+		return json.Unmarshal([]byte(value), m)
+	}
+
+	return errors.New("metadata must be a JSON object")
 }
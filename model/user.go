@@ -43,6 +43,11 @@ type SubscriptionPlan struct {
 	Currency    string  `json:"currency"`
 	Duration    int     `json:"duration"` // in days
 	IsActive    bool    `json:"is_active"`
+
+	MaxUploadSize   int64 `json:"max_upload_size"`   // in bytes, 0 falls back to the free tier limit
+	MaxFileVersions int   `json:"max_file_versions"` // versions kept per file, 0 falls back to the free tier limit
+	StorageQuota    int64 `json:"storage_quota"`     // in bytes, 0 falls back to the free tier quota
+	MaxArchiveSize  int64 `json:"max_archive_size"`  // bytes of files per archive download, 0 falls back to the free tier limit
 }
 
 type UserSubscription struct {
@@ -1,6 +1,10 @@
 package request
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
 
 type CreateFolderRequest struct {
 	Name     string     `json:"name"`
@@ -10,3 +14,99 @@ type CreateFolderRequest struct {
 type UpdateFolderRequest struct {
 	CreateFolderRequest
 }
+
+type CreateDirectUploadRequest struct {
+	FileName    string     `json:"file_name"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	Visibility  string     `json:"visibility"`
+	FolderID    *uuid.UUID `json:"folder_id"`
+}
+
+type UpdateFileRequest struct {
+	OriginalName *string    `json:"original_name"`
+	FolderID     *uuid.UUID `json:"folder_id"`
+	// MoveToRoot moves the file out of its folder, folder_id is ignored when it is set
+	MoveToRoot bool `json:"move_to_root"`
+	// OnConflict is "error" (default) or "rename" to add a numeric suffix to clashing names
+	OnConflict string `json:"on_conflict"`
+}
+
+type UpdateMetadataRequest struct {
+	// Metadata is merged into the file's metadata, keys set to null are removed
+	Metadata map[string]*string `json:"metadata"`
+}
+
+type SetExpiryRequest struct {
+	// ExpiresAt is an RFC 3339 time, TTL a number of seconds or a duration such as "72h"
+	ExpiresAt string          `json:"expires_at"`
+	TTL       json.RawMessage `json:"ttl"`
+	// ExpiryWarning emails the owner shortly before the file expires
+	ExpiryWarning bool `json:"expiry_warning"`
+}
+
+type MoveFilesRequest struct {
+	FileIDs []uuid.UUID `json:"file_ids"`
+	// FolderID is the destination folder, null moves the files to the root
+	FolderID   *uuid.UUID `json:"folder_id"`
+	OnConflict string     `json:"on_conflict"`
+}
+
+type ArchiveFilesRequest struct {
+	FileIDs []uuid.UUID `json:"file_ids"`
+}
+
+type CreateSignedURLRequest struct {
+	// ExpiresIn is the lifetime of the URL in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type ContentTypeRuleRequest struct {
+	// Pattern is a content type such as application/pdf, a family such as image/* or */*
+	Pattern string `json:"pattern"`
+	// ScriptOnly limits a blocking rule to markup that carries script, it is ignored for allowed types
+	ScriptOnly bool `json:"script_only"`
+}
+
+type CreateTagRequest struct {
+	Name string `json:"name"`
+	// Color is an optional hex color such as #1a2b3c
+	Color string `json:"color"`
+}
+
+type UpdateTagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type TagItemsRequest struct {
+	TagIDs    []uuid.UUID `json:"tag_ids"`
+	FileIDs   []uuid.UUID `json:"file_ids"`
+	FolderIDs []uuid.UUID `json:"folder_ids"`
+}
+
+type CreateShareLinkRequest struct {
+	// FileID or FolderID is what the link shares, exactly one of them must be set
+	FileID   *uuid.UUID `json:"file_id"`
+	FolderID *uuid.UUID `json:"folder_id"`
+	// Password is asked from visitors when it is set
+	Password string `json:"password"`
+	// ExpiresAt is an RFC 3339 time, TTL a number of seconds or a duration such as "72h"
+	ExpiresAt    string          `json:"expires_at"`
+	TTL          json.RawMessage `json:"ttl"`
+	MaxDownloads *int64          `json:"max_downloads"`
+}
+
+type GrantPermissionRequest struct {
+	// Email is the address of the user the item is shared with
+	Email string `json:"email"`
+	// FileID or FolderID is what is shared, exactly one of them must be set
+	FileID   *uuid.UUID `json:"file_id"`
+	FolderID *uuid.UUID `json:"folder_id"`
+	// Role is viewer, editor or owner
+	Role string `json:"role"`
+}
+
+type UpdatePermissionRequest struct {
+	Role string `json:"role"`
+}
@@ -6,6 +6,11 @@ type CreatePlan struct {
 	Price       float64 `json:"price" validate:"required,gt=0"`
 	Currency    string  `json:"currency" validate:"required,len=3"`
 	Duration    int     `json:"duration" validate:"required,gt=0"` // days
+
+	MaxUploadSize   int64 `json:"max_upload_size" validate:"omitempty,gte=0"` // bytes
+	MaxFileVersions int   `json:"max_file_versions" validate:"omitempty,gte=0"`
+	StorageQuota    int64 `json:"storage_quota" validate:"omitempty,gte=0"`    // bytes
+	MaxArchiveSize  int64 `json:"max_archive_size" validate:"omitempty,gte=0"` // bytes
 }
 
 type UpdatePlan struct {
@@ -14,4 +19,9 @@ type UpdatePlan struct {
 	Price       float64 `json:"price" validate:"omitempty,gt=0"`
 	Duration    int     `json:"duration" validate:"omitempty,gt=0"` // days
 	IsActive    *bool   `json:"is_active"`
+
+	MaxUploadSize   *int64 `json:"max_upload_size" validate:"omitempty,gte=0"` // bytes
+	MaxFileVersions *int   `json:"max_file_versions" validate:"omitempty,gte=0"`
+	StorageQuota    *int64 `json:"storage_quota" validate:"omitempty,gte=0"`    // bytes
+	MaxArchiveSize  *int64 `json:"max_archive_size" validate:"omitempty,gte=0"` // bytes
 }
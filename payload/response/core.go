@@ -41,3 +41,13 @@ type CategoryResponse struct {
 type WishlistResponse struct {
 	Product ProductResponse `json:"product"`
 }
+
+// BatchUploadResult reports the outcome of one file of a batch upload
+type BatchUploadResult struct {
+	Index    int         `json:"index"`
+	FileName string      `json:"file_name"`
+	Success  bool        `json:"success"`
+	Status   int         `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	File     interface{} `json:"file,omitempty"`
+}
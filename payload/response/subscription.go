@@ -13,6 +13,11 @@ type SubscriptionPlan struct {
 	Price       float64 `json:"price"`
 	Currency    string  `json:"currency"`
 	Duration    int     `json:"duration"`
+
+	MaxUploadSize   int64 `json:"max_upload_size"`
+	MaxFileVersions int   `json:"max_file_versions"`
+	StorageQuota    int64 `json:"storage_quota"`
+	MaxArchiveSize  int64 `json:"max_archive_size"`
 }
 
 type UserSubscription struct {
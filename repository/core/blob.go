@@ -0,0 +1,141 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type BlobRepositoryInterface interface {
+	AcquireBlob(blob model.Blob) (model.Blob, error)
+	FindBlobById(id uuid.UUID) (model.Blob, error)
+	AddReference(id uuid.UUID) error
+	ReleaseBlob(id uuid.UUID) (model.Blob, bool, error)
+	FindBlobsByScanStatus(status string, limit int) ([]model.Blob, error)
+	UpdateScanResult(id uuid.UUID, status string, signature string) error
+}
+
+type blobRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewBlobRepository(database database.DatabaseInterface) BlobRepositoryInterface {
+	return &blobRepository{database: database}
+}
+
+// AcquireBlob takes a reference on the user's blob with the same hash, creating it from the given
+// one when there is none. The returned blob's path tells the caller which object holds the content.
+// A created blob is added to the user's storage usage.
+func (b *blobRepository) AcquireBlob(blob model.Blob) (model.Blob, error) {
+	var acquired model.Blob
+
+	blob.Prepare()
+
+	err := b.database.Connection().Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+			INSERT INTO blobs (id, created_at, updated_at, user_id, hash, path, size, wrapped_key, ref_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT (user_id, hash) DO UPDATE SET ref_count = blobs.ref_count + 1, updated_at = EXCLUDED.updated_at
+			RETURNING *`,
+			blob.ID, time.Now(), time.Now(), blob.UserID, blob.Hash, blob.Path, blob.Size, blob.WrappedKey,
+		).Scan(&acquired).Error
+		if err != nil {
+			return err
+		}
+
+		// only the reference that created the blob sees a count of 1
+		if acquired.RefCount != 1 {
+			return nil
+		}
+
+		return addStorageUsage(tx, acquired.UserID, acquired.Size)
+	})
+
+	return acquired, err
+}
+
+// FindBlobById implements BlobRepositoryInterface.
+func (b *blobRepository) FindBlobById(id uuid.UUID) (model.Blob, error) {
+	var blob model.Blob
+
+	err := b.database.Connection().Where("id = ?", id).First(&blob).Error
+
+	return blob, err
+}
+
+// AddReference takes one more reference on an existing blob
+func (b *blobRepository) AddReference(id uuid.UUID) error {
+	result := b.database.Connection().
+		Model(&model.Blob{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"ref_count": gorm.Expr("ref_count + 1"), "updated_at": time.Now()})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReleaseBlob drops a reference on the blob and deletes it once nothing refers to it anymore, taking
+// it off the user's storage usage. It returns true when the blob was deleted, in which case its object
+// should be removed too.
+func (b *blobRepository) ReleaseBlob(id uuid.UUID) (model.Blob, bool, error) {
+	var released model.Blob
+	deleted := false
+
+	err := b.database.Connection().Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.Blob{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"ref_count": gorm.Expr("ref_count - 1"), "updated_at": time.Now()}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Raw("DELETE FROM blobs WHERE id = ? AND ref_count <= 0 RETURNING *", id).Scan(&released)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		deleted = result.RowsAffected > 0
+		if !deleted {
+			return nil
+		}
+
+		return addStorageUsage(tx, released.UserID, -released.Size)
+	})
+
+	return released, deleted, err
+}
+
+// FindBlobsByScanStatus returns up to limit blobs in the given scan status, oldest first
+func (b *blobRepository) FindBlobsByScanStatus(status string, limit int) ([]model.Blob, error) {
+	var blobs []model.Blob
+
+	err := b.database.Connection().
+		Where("scan_status = ?", status).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&blobs).
+		Error
+
+	return blobs, err
+}
+
+// UpdateScanResult records the outcome of scanning a blob's content
+func (b *blobRepository) UpdateScanResult(id uuid.UUID, status string, signature string) error {
+	return b.database.Connection().
+		Model(&model.Blob{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"scan_status": status, "scan_signature": signature, "scanned_at": time.Now()}).
+		Error
+}
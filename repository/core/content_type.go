@@ -0,0 +1,67 @@
+package core_repository
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type ContentTypeRuleRepositoryInterface interface {
+	CreateRule(rule model.ContentTypeRule) (model.ContentTypeRule, error)
+	FindGlobalRules() ([]model.ContentTypeRule, error)
+	FindUserRules(userId uuid.UUID) ([]model.ContentTypeRule, error)
+	FindRuleById(id uuid.UUID) (model.ContentTypeRule, error)
+	DeleteRule(id uuid.UUID) error
+}
+
+type contentTypeRuleRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewContentTypeRuleRepository(database database.DatabaseInterface) ContentTypeRuleRepositoryInterface {
+	return &contentTypeRuleRepository{database: database}
+}
+
+// CreateRule implements ContentTypeRuleRepositoryInterface.
+func (r *contentTypeRuleRepository) CreateRule(rule model.ContentTypeRule) (model.ContentTypeRule, error) {
+	rule.Prepare()
+
+	if err := r.database.Connection().Create(&rule).Error; err != nil {
+		return model.ContentTypeRule{}, err
+	}
+
+	return rule, nil
+}
+
+// FindGlobalRules implements ContentTypeRuleRepositoryInterface.
+func (r *contentTypeRuleRepository) FindGlobalRules() ([]model.ContentTypeRule, error) {
+	var rules []model.ContentTypeRule
+
+	err := r.database.Connection().Where("user_id IS NULL").Order("pattern").Find(&rules).Error
+
+	return rules, err
+}
+
+// FindUserRules implements ContentTypeRuleRepositoryInterface.
+func (r *contentTypeRuleRepository) FindUserRules(userId uuid.UUID) ([]model.ContentTypeRule, error) {
+	var rules []model.ContentTypeRule
+
+	err := r.database.Connection().Where("user_id = ?", userId).Order("pattern").Find(&rules).Error
+
+	return rules, err
+}
+
+// FindRuleById implements ContentTypeRuleRepositoryInterface.
+func (r *contentTypeRuleRepository) FindRuleById(id uuid.UUID) (model.ContentTypeRule, error) {
+	var rule model.ContentTypeRule
+
+	err := r.database.Connection().Where("id = ?", id).First(&rule).Error
+
+	return rule, err
+}
+
+// DeleteRule implements ContentTypeRuleRepositoryInterface.
+func (r *contentTypeRuleRepository) DeleteRule(id uuid.UUID) error {
+	return r.database.Connection().Unscoped().Delete(&model.ContentTypeRule{}, "id = ?", id).Error
+}
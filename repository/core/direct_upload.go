@@ -0,0 +1,62 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type DirectUploadRepositoryInterface interface {
+	CreateDirectUpload(upload model.DirectUpload) (model.DirectUpload, error)
+	FindDirectUploadById(id uuid.UUID) (model.DirectUpload, error)
+	FindExpiredDirectUploads(before time.Time) ([]model.DirectUpload, error)
+	DeleteDirectUpload(id uuid.UUID) (bool, error)
+}
+
+type directUploadRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewDirectUploadRepository(database database.DatabaseInterface) DirectUploadRepositoryInterface {
+	return &directUploadRepository{database: database}
+}
+
+// CreateDirectUpload implements DirectUploadRepositoryInterface.
+func (d *directUploadRepository) CreateDirectUpload(upload model.DirectUpload) (model.DirectUpload, error) {
+	upload.Prepare()
+
+	if err := d.database.Connection().Create(&upload).Error; err != nil {
+		return model.DirectUpload{}, err
+	}
+
+	return upload, nil
+}
+
+// FindDirectUploadById implements DirectUploadRepositoryInterface.
+func (d *directUploadRepository) FindDirectUploadById(id uuid.UUID) (model.DirectUpload, error) {
+	var upload model.DirectUpload
+
+	err := d.database.Connection().Where("id = ?", id).First(&upload).Error
+
+	return upload, err
+}
+
+// FindExpiredDirectUploads implements DirectUploadRepositoryInterface.
+func (d *directUploadRepository) FindExpiredDirectUploads(before time.Time) ([]model.DirectUpload, error) {
+	var uploads []model.DirectUpload
+
+	err := d.database.Connection().Where("expires_at < ?", before).Find(&uploads).Error
+
+	return uploads, err
+}
+
+// DeleteDirectUpload removes the pending upload and reports whether this call was the one that removed it,
+// so a finalize and the garbage collector can't both act on the same object.
+func (d *directUploadRepository) DeleteDirectUpload(id uuid.UUID) (bool, error) {
+	result := d.database.Connection().Unscoped().Delete(&model.DirectUpload{}, "id = ?", id)
+
+	return result.RowsAffected > 0, result.Error
+}
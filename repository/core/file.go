@@ -2,10 +2,14 @@ package core_repository
 
 import (
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/lib/helper"
 	"github.com/shordem/api.thryvo/model"
 	"github.com/shordem/api.thryvo/repository"
 )
@@ -16,6 +20,59 @@ type FilePageable struct {
 	UserId    uuid.UUID `json:"user_id"`
 	FolderId  uuid.UUID `json:"folder_id"`
 	HasFolder bool      `json:"has_folder"`
+	// Trashed lists deleted files instead, regardless of their folder
+	Trashed bool `json:"trashed"`
+
+	Filters FileFilters `json:"filters"`
+}
+
+// FileFilters narrow down FindAllFiles, zero values don't filter. Searches and filters look through
+// every folder unless a folder is asked for.
+type FileFilters struct {
+	// MimeTypes are exact types or families such as image/*, files match any of them
+	MimeTypes []string `json:"mime_types"`
+	// Extensions are matched case-insensitively against the end of the name, files match any of them
+	Extensions    []string   `json:"extensions"`
+	MinSize       *int64     `json:"min_size"`
+	MaxSize       *int64     `json:"max_size"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+	UpdatedAfter  *time.Time `json:"updated_after"`
+	UpdatedBefore *time.Time `json:"updated_before"`
+	Visibility    string     `json:"visibility"`
+	// Tags are tag names, files need all of them or any of them depending on TagMatch
+	Tags     []string `json:"tags"`
+	TagMatch string   `json:"tag_match"`
+	// Metadata are key-value pairs files must have, all of them
+	Metadata map[string]string `json:"metadata"`
+	// ScanStatus matches the malware scan status of the files' current content
+	ScanStatus string `json:"scan_status"`
+}
+
+var (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+func (f FileFilters) IsZero() bool {
+	return len(f.MimeTypes) == 0 && len(f.Extensions) == 0 &&
+		f.MinSize == nil && f.MaxSize == nil &&
+		f.CreatedAfter == nil && f.CreatedBefore == nil &&
+		f.UpdatedAfter == nil && f.UpdatedBefore == nil &&
+		f.Visibility == "" && len(f.Tags) == 0 && len(f.Metadata) == 0 &&
+		f.ScanStatus == ""
+}
+
+// FileSortRelevance orders search results by how similar their name is to the search
+const FileSortRelevance = "relevance"
+
+// fileSortColumns are the columns files can be sorted by
+var fileSortColumns = map[string]bool{
+	"created_at":    true,
+	"updated_at":    true,
+	"original_name": true,
+	"size":          true,
+	"mime_type":     true,
 }
 
 type FileRepositoryInterface interface {
@@ -25,6 +82,26 @@ type FileRepositoryInterface interface {
 	FindFileByKeyName(keyName string) (model.File, error)
 	UpdateFile(file model.File) (model.File, error)
 	DeleteFile(uuid uuid.UUID) error
+	FindTrashedFileById(uuid uuid.UUID) (model.File, error)
+	FindFilesTrashedBefore(before time.Time, limit int) ([]model.File, error)
+	RestoreFile(uuid uuid.UUID, folderId *uuid.UUID) error
+	PurgeFile(uuid uuid.UUID) (bool, error)
+	FindFilesByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.File, error)
+	FindFilesInFolders(userId uuid.UUID, folderIds []uuid.UUID) ([]model.File, error)
+	FindFileNamesInFolder(userId uuid.UUID, folderId *uuid.UUID) ([]string, error)
+	UpdateFileLocations(files []model.File) error
+	UpdateFileMetadata(uuid uuid.UUID, metadata model.Metadata) error
+	UpdateFileExpiry(uuid uuid.UUID, expiresAt *time.Time, warning bool) error
+	FindFilesExpiredBefore(before time.Time, limit int) ([]model.File, error)
+	PurgeExpiredFile(uuid uuid.UUID, before time.Time) (bool, error)
+	FindFilesExpiringBefore(before time.Time, limit int) ([]model.File, error)
+	MarkExpiryWarned(uuids []uuid.UUID) error
+	FindStorageReferences(userId uuid.UUID) (StorageReferences, error)
+	FindFilesWithContent(userId uuid.UUID) ([]model.File, error)
+	FindFilesByBlob(blobId uuid.UUID) ([]model.File, error)
+	FindFilesByProcessingStatus(status string, limit int) ([]model.File, error)
+	CompleteProcessing(uuid uuid.UUID, blobId uuid.UUID, hash string, md5 string, size int64) (bool, error)
+	DeletePendingFile(uuid uuid.UUID) (bool, error)
 }
 
 type fileRepository struct {
@@ -52,7 +129,7 @@ func (f *fileRepository) CreateFile(file model.File) (model.File, error) {
 func (f *fileRepository) FindFileById(uuid uuid.UUID) (model.File, error) {
 	var file model.File
 
-	err := f.database.Connection().Where("id = ?", uuid).First(&file).Error
+	err := f.database.Connection().Preload("Blob").Where("id = ?", uuid).First(&file).Error
 
 	return file, err
 }
@@ -61,7 +138,7 @@ func (f *fileRepository) FindFileById(uuid uuid.UUID) (model.File, error) {
 func (f *fileRepository) FindFileByKeyName(keyName string) (model.File, error) {
 	var file model.File
 
-	err := f.database.Connection().Where("key = ?", keyName).First(&file).Error
+	err := f.database.Connection().Preload("Blob").Where("key = ?", keyName).First(&file).Error
 
 	return file, err
 }
@@ -94,20 +171,34 @@ func (f *fileRepository) FindAllFiles(pageable FilePageable) (files []model.File
 
 	search := strings.TrimSpace(pageable.Search)
 	offset := (pageable.Page - 1) * pageable.Size
-	model := f.database.Connection().Model(&file).Preload("Folder")
+	model := f.database.Connection().Model(&file).Preload("Folder").Preload("Blob").Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	})
 
-	if len(search) > 0 {
-		model = model.Where("original_name LIKE ?", "%"+search+"%")
+	// every word has to appear in the name, the trigram index on original_name serves ILIKE
+	for _, term := range strings.Fields(search) {
+		model = model.Where("original_name ILIKE ?", "%"+helper.EscapeLike(term)+"%")
+	}
+
+	model = applyFileFilters(model, pageable.Filters)
+
+	if pageable.Trashed {
+		model = model.Unscoped().Where("deleted_at IS NOT NULL")
+	} else {
+		// expired files are gone to their owner even before the sweeper gets to them
+		model = model.Where("expires_at IS NULL OR expires_at > ?", time.Now())
 	}
 
 	if pageable.UserId != uuid.Nil {
 		model = model.Where("user_id = ?", pageable.UserId)
 
-		if pageable.FolderId != uuid.Nil {
+		if !pageable.Trashed && pageable.FolderId != uuid.Nil {
 			model = model.Where("folder_id = ?", pageable.FolderId)
 		}
 
-		if !pageable.HasFolder && pageable.FolderId == uuid.Nil {
+		browsing := search == "" && pageable.Filters.IsZero()
+
+		if !pageable.Trashed && !pageable.HasFolder && pageable.FolderId == uuid.Nil && browsing {
 			model = model.Where("folder_id IS NULL")
 		}
 	}
@@ -119,8 +210,25 @@ func (f *fileRepository) FindAllFiles(pageable FilePageable) (files []model.File
 	// apply pagination
 	paginatedQuery := model.
 		Offset(offset).
-		Limit(pageable.Size).
-		Order(pageable.SortBy + " " + pageable.SortDirection)
+		Limit(pageable.Size)
+
+	direction := "DESC"
+	if strings.EqualFold(pageable.SortDirection, "asc") {
+		direction = "ASC"
+	}
+
+	switch {
+	case pageable.SortBy == FileSortRelevance && search != "":
+		paginatedQuery = paginatedQuery.Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "similarity(original_name, ?) DESC, created_at DESC",
+			Vars:               []interface{}{search},
+			WithoutParentheses: true,
+		}})
+	case fileSortColumns[pageable.SortBy]:
+		paginatedQuery = paginatedQuery.Order(pageable.SortBy + " " + direction)
+	default:
+		paginatedQuery = paginatedQuery.Order("created_at " + direction)
+	}
 
 	if err = paginatedQuery.Find(&files).Error; err != nil {
 		return nil, pagination, err
@@ -135,10 +243,100 @@ func (f *fileRepository) FindAllFiles(pageable FilePageable) (files []model.File
 	return files, pagination, err
 }
 
+// applyFileFilters adds the conditions of filters to query
+func applyFileFilters(query *gorm.DB, filters FileFilters) *gorm.DB {
+	if len(filters.MimeTypes) > 0 {
+		conditions := []string{}
+		args := []interface{}{}
+
+		for _, mimeType := range filters.MimeTypes {
+			if family, ok := strings.CutSuffix(mimeType, "/*"); ok {
+				conditions = append(conditions, "mime_type LIKE ?")
+				args = append(args, helper.EscapeLike(family)+"/%")
+			} else {
+				conditions = append(conditions, "mime_type = ?")
+				args = append(args, mimeType)
+			}
+		}
+
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	if len(filters.Extensions) > 0 {
+		conditions := []string{}
+		args := []interface{}{}
+
+		for _, ext := range filters.Extensions {
+			conditions = append(conditions, "original_name ILIKE ?")
+			args = append(args, "%."+helper.EscapeLike(ext))
+		}
+
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	if filters.MinSize != nil {
+		query = query.Where("size >= ?", *filters.MinSize)
+	}
+
+	if filters.MaxSize != nil {
+		query = query.Where("size <= ?", *filters.MaxSize)
+	}
+
+	if filters.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filters.CreatedAfter)
+	}
+
+	if filters.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filters.CreatedBefore)
+	}
+
+	if filters.UpdatedAfter != nil {
+		query = query.Where("updated_at >= ?", *filters.UpdatedAfter)
+	}
+
+	if filters.UpdatedBefore != nil {
+		query = query.Where("updated_at < ?", *filters.UpdatedBefore)
+	}
+
+	if filters.Visibility != "" {
+		query = query.Where("visibility = ?", filters.Visibility)
+	}
+
+	if filters.ScanStatus != "" {
+		query = query.Where("blob_id IN (SELECT id FROM blobs WHERE scan_status = ?)", filters.ScanStatus)
+	}
+
+	if len(filters.Metadata) > 0 {
+		// containment is served by the GIN index on metadata
+		query = query.Where("metadata @> ?", model.Metadata(filters.Metadata))
+	}
+
+	if len(filters.Tags) > 0 {
+		names := map[string]bool{}
+		for _, name := range filters.Tags {
+			names[strings.ToLower(name)] = true
+		}
+
+		lowered := []string{}
+		for name := range names {
+			lowered = append(lowered, name)
+		}
+
+		matching := "SELECT COUNT(DISTINCT tags.id) FROM file_tags JOIN tags ON tags.id = file_tags.tag_id " +
+			"WHERE file_tags.file_id = files.id AND LOWER(tags.name) IN ?"
+
+		if filters.TagMatch == TagMatchAny {
+			query = query.Where("("+matching+") > 0", lowered)
+		} else {
+			query = query.Where("("+matching+") = ?", lowered, len(lowered))
+		}
+	}
+
+	return query
+}
+
 // UpdateFile implements FileRepositoryInterface.
 func (f *fileRepository) UpdateFile(file model.File) (model.File, error) {
-	file.Prepare()
-
 	err := f.database.Connection().Save(&file).Error
 
 	if err != nil {
@@ -147,3 +345,332 @@ func (f *fileRepository) UpdateFile(file model.File) (model.File, error) {
 
 	return file, err
 }
+
+// FindTrashedFileById implements FileRepositoryInterface.
+func (f *fileRepository) FindTrashedFileById(uuid uuid.UUID) (model.File, error) {
+	var file model.File
+
+	err := f.database.Connection().
+		Unscoped().
+		Preload("Blob").
+		Where("id = ? AND deleted_at IS NOT NULL", uuid).
+		First(&file).
+		Error
+
+	return file, err
+}
+
+// FindFilesTrashedBefore implements FileRepositoryInterface.
+func (f *fileRepository) FindFilesTrashedBefore(before time.Time, limit int) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// RestoreFile takes a file out of the trash and puts it in folderId
+func (f *fileRepository) RestoreFile(uuid uuid.UUID, folderId *uuid.UUID) error {
+	return f.database.Connection().
+		Unscoped().
+		Model(&model.File{}).
+		Where("id = ? AND deleted_at IS NOT NULL", uuid).
+		Updates(map[string]interface{}{"deleted_at": nil, "folder_id": folderId, "updated_at": time.Now()}).
+		Error
+}
+
+// PurgeFile permanently deletes a trashed file row and reports whether it was still there
+func (f *fileRepository) PurgeFile(uuid uuid.UUID) (bool, error) {
+	result := f.database.Connection().
+		Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", uuid).
+		Delete(&model.File{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindFilesByIds implements FileRepositoryInterface.
+func (f *fileRepository) FindFilesByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().Where("user_id = ? AND id IN ?", userId, ids).Find(&files).Error
+
+	return files, err
+}
+
+// FindFilesInFolders returns the user's files in any of the folders, ordered by name
+func (f *fileRepository) FindFilesInFolders(userId uuid.UUID, folderIds []uuid.UUID) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Preload("Blob").
+		Where("user_id = ? AND folder_id IN ?", userId, folderIds).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("original_name ASC").
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// FindFileNamesInFolder returns the names of the user's files in a folder, or in the root when folderId is nil
+func (f *fileRepository) FindFileNamesInFolder(userId uuid.UUID, folderId *uuid.UUID) ([]string, error) {
+	var names []string
+
+	query := f.database.Connection().Model(&model.File{}).Where("user_id = ?", userId)
+
+	if folderId != nil {
+		query = query.Where("folder_id = ?", *folderId)
+	} else {
+		query = query.Where("folder_id IS NULL")
+	}
+
+	err := query.Pluck("original_name", &names).Error
+
+	return names, err
+}
+
+// UpdateFileLocations saves the name and folder of every file in one transaction
+func (f *fileRepository) UpdateFileLocations(files []model.File) error {
+	return f.database.Connection().Transaction(func(tx *gorm.DB) error {
+		for _, file := range files {
+			result := tx.Model(&model.File{}).
+				Where("id = ? AND user_id = ?", file.ID, file.UserID).
+				Updates(map[string]interface{}{
+					"original_name": file.OriginalName,
+					"folder_id":     file.FolderID,
+					"updated_at":    time.Now(),
+				})
+
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		return nil
+	})
+}
+
+// UpdateFileMetadata replaces the metadata of a file
+func (f *fileRepository) UpdateFileMetadata(uuid uuid.UUID, metadata model.Metadata) error {
+	return f.database.Connection().
+		Model(&model.File{}).
+		Where("id = ?", uuid).
+		Updates(map[string]interface{}{"metadata": metadata, "updated_at": time.Now()}).
+		Error
+}
+
+// UpdateFileExpiry sets when a file expires and whether its owner is warned before, a warning
+// already sent for an earlier expiry no longer counts
+func (f *fileRepository) UpdateFileExpiry(uuid uuid.UUID, expiresAt *time.Time, warning bool) error {
+	return f.database.Connection().
+		Model(&model.File{}).
+		Where("id = ?", uuid).
+		Updates(map[string]interface{}{
+			"expires_at":       expiresAt,
+			"expiry_warning":   warning,
+			"expiry_warned_at": nil,
+			"updated_at":       time.Now(),
+		}).
+		Error
+}
+
+// FindFilesExpiredBefore returns files, trashed ones included, that expired before the given time
+func (f *fileRepository) FindFilesExpiredBefore(before time.Time, limit int) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Unscoped().
+		Where("expires_at IS NOT NULL AND expires_at <= ?", before).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// PurgeExpiredFile permanently deletes a file row if it still expired before the given time
+// and reports whether it did, the expiry may have been moved in the meantime
+func (f *fileRepository) PurgeExpiredFile(uuid uuid.UUID, before time.Time) (bool, error) {
+	result := f.database.Connection().
+		Unscoped().
+		Where("id = ? AND expires_at IS NOT NULL AND expires_at <= ?", uuid, before).
+		Delete(&model.File{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindFilesExpiringBefore returns files whose owner asked to be warned, that expire before
+// the given time and haven't been warned about yet
+func (f *fileRepository) FindFilesExpiringBefore(before time.Time, limit int) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Where("expiry_warning = ? AND expiry_warned_at IS NULL", true).
+		Where("expires_at > ? AND expires_at <= ?", time.Now(), before).
+		Order("user_id, expires_at").
+		Limit(limit).
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// MarkExpiryWarned records that the owners of the files were warned
+func (f *fileRepository) MarkExpiryWarned(uuids []uuid.UUID) error {
+	return f.database.Connection().
+		Model(&model.File{}).
+		Where("id IN ?", uuids).
+		Update("expiry_warned_at", time.Now()).
+		Error
+}
+
+// StorageReferences is everything of a user's that may refer to a stored object
+type StorageReferences struct {
+	// Paths are full object paths, held by blobs and by chunks of resumable uploads
+	Paths []string
+	// Keys are keys below the user's prefix, held by files from before deduplication and pending direct uploads
+	Keys []string
+	// ContentIDs identify content that transformed images may be cached for
+	ContentIDs []string
+}
+
+// FindStorageReferences collects the object references of a user, trashed files included
+func (f *fileRepository) FindStorageReferences(userId uuid.UUID) (StorageReferences, error) {
+	var references StorageReferences
+	db := f.database.Connection()
+
+	err := db.Raw(`
+		SELECT path FROM blobs WHERE user_id = ?
+		UNION SELECT c.path FROM upload_chunks c JOIN upload_sessions s ON s.id = c.upload_session_id WHERE s.user_id = ?`,
+		userId, userId,
+	).Scan(&references.Paths).Error
+	if err != nil {
+		return references, err
+	}
+
+	err = db.Raw(`
+		SELECT key FROM files WHERE user_id = ? AND blob_id IS NULL
+		UNION SELECT key FROM direct_uploads WHERE owner_id = ?`,
+		userId, userId,
+	).Scan(&references.Keys).Error
+	if err != nil {
+		return references, err
+	}
+
+	// content without a hash is identified by its key and version number
+	err = db.Raw(`
+		SELECT hash FROM blobs WHERE user_id = ?
+		UNION SELECT key || '-' || version FROM files WHERE user_id = ? AND hash IS NULL
+		UNION SELECT f.key || '-' || v.number FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.user_id = ? AND v.hash IS NULL`,
+		userId, userId, userId,
+	).Scan(&references.ContentIDs).Error
+
+	return references, err
+}
+
+// FindFilesWithContent returns all of a user's files, trashed ones included, with the blobs of their versions
+func (f *fileRepository) FindFilesWithContent(userId uuid.UUID) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Unscoped().
+		Preload("Blob").
+		Preload("Versions.Blob").
+		Where("user_id = ?", userId).
+		Order("created_at ASC").
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// FindFilesByBlob returns the files holding the blob as their current content or as one of their versions
+func (f *fileRepository) FindFilesByBlob(blobId uuid.UUID) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Where("blob_id = ? OR id IN (SELECT file_id FROM file_versions WHERE blob_id = ?)", blobId, blobId).
+		Order("original_name ASC").
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// FindFilesByProcessingStatus returns up to limit files in the given processing status, trashed ones
+// included, oldest first
+func (f *fileRepository) FindFilesByProcessingStatus(status string, limit int) ([]model.File, error) {
+	var files []model.File
+
+	err := f.database.Connection().
+		Unscoped().
+		Where("processing_status = ?", status).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&files).
+		Error
+
+	return files, err
+}
+
+// CompleteProcessing gives the first version of a pending file its blob and digests, the file row too
+// while that version is still current. It returns false when the version is gone, in which case nothing
+// holds the blob reference.
+func (f *fileRepository) CompleteProcessing(uuid uuid.UUID, blobId uuid.UUID, hash string, md5 string, size int64) (bool, error) {
+	completed := false
+
+	err := f.database.Connection().Transaction(func(tx *gorm.DB) error {
+		content := map[string]interface{}{"blob_id": blobId, "hash": hash, "md5": md5, "size": size}
+
+		result := tx.Model(&model.FileVersion{}).
+			Where("file_id = ? AND number = 1 AND blob_id IS NULL", uuid).
+			Updates(content)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		completed = result.RowsAffected > 0
+		if !completed {
+			return nil
+		}
+
+		err := tx.Unscoped().
+			Model(&model.File{}).
+			Where("id = ? AND version = 1", uuid).
+			Updates(content).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().
+			Model(&model.File{}).
+			Where("id = ?", uuid).
+			Updates(map[string]interface{}{"processing_status": "ready", "updated_at": time.Now()}).
+			Error
+	})
+
+	return completed, err
+}
+
+// DeletePendingFile removes a file for good as long as its content is still pending
+func (f *fileRepository) DeletePendingFile(uuid uuid.UUID) (bool, error) {
+	result := f.database.Connection().
+		Unscoped().
+		Where("id = ? AND processing_status = ?", uuid, "pending").
+		Delete(&model.File{})
+
+	return result.RowsAffected > 0, result.Error
+}
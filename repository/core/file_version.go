@@ -0,0 +1,102 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type FileVersionRepositoryInterface interface {
+	AddVersion(version model.FileVersion) (model.FileVersion, error)
+	FindVersionsByFileId(fileId uuid.UUID) ([]model.FileVersion, error)
+	FindVersion(fileId uuid.UUID, number int) (model.FileVersion, error)
+	DeleteVersion(id uuid.UUID) error
+}
+
+type fileVersionRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewFileVersionRepository(database database.DatabaseInterface) FileVersionRepositoryInterface {
+	return &fileVersionRepository{database: database}
+}
+
+// AddVersion stores version as the newest version of its file and makes it the file's current content.
+// The version number is assigned here while the file row is locked.
+func (f *fileVersionRepository) AddVersion(version model.FileVersion) (model.FileVersion, error) {
+	err := f.database.Connection().Transaction(func(tx *gorm.DB) error {
+		var file model.File
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", version.FileID).First(&file).Error; err != nil {
+			return err
+		}
+
+		var latest int
+		err := tx.Model(&model.FileVersion{}).
+			Where("file_id = ?", version.FileID).
+			Select("COALESCE(MAX(number), 0)").
+			Scan(&latest).
+			Error
+		if err != nil {
+			return err
+		}
+
+		version.Prepare()
+		version.Number = latest + 1
+
+		if err := tx.Omit(clause.Associations).Create(&version).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.File{}).
+			Where("id = ?", version.FileID).
+			Updates(map[string]interface{}{
+				"blob_id":    version.BlobID,
+				"hash":       version.Hash,
+				"md5":        version.MD5,
+				"size":       version.Size,
+				"mime_type":  version.MimeType,
+				"version":    version.Number,
+				"updated_at": time.Now(),
+			}).
+			Error
+	})
+
+	return version, err
+}
+
+// FindVersionsByFileId returns the versions of a file, newest first
+func (f *fileVersionRepository) FindVersionsByFileId(fileId uuid.UUID) ([]model.FileVersion, error) {
+	var versions []model.FileVersion
+
+	err := f.database.Connection().
+		Where("file_id = ?", fileId).
+		Order("number DESC").
+		Find(&versions).
+		Error
+
+	return versions, err
+}
+
+// FindVersion implements FileVersionRepositoryInterface.
+func (f *fileVersionRepository) FindVersion(fileId uuid.UUID, number int) (model.FileVersion, error) {
+	var version model.FileVersion
+
+	err := f.database.Connection().
+		Preload("Blob").
+		Where("file_id = ? AND number = ?", fileId, number).
+		First(&version).
+		Error
+
+	return version, err
+}
+
+// DeleteVersion implements FileVersionRepositoryInterface.
+func (f *fileVersionRepository) DeleteVersion(id uuid.UUID) error {
+	return f.database.Connection().Unscoped().Delete(&model.FileVersion{}, "id = ?", id).Error
+}
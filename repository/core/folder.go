@@ -14,6 +14,7 @@ type FolderRepositoryInterface interface {
 	FindFoldersByUserId(userId uuid.UUID) ([]model.Folder, error)
 	FindFoldersByParentId(userId uuid.UUID, parentId uuid.UUID) ([]model.Folder, error)
 	FindFolderById(id uuid.UUID) (model.Folder, error)
+	FindFoldersByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.Folder, error)
 	UpdateFolder(folder model.Folder) (model.Folder, error)
 	DeleteFolder(id uuid.UUID, userId uuid.UUID) error
 }
@@ -48,6 +49,7 @@ func (f *folderRepository) FindFoldersByUserId(userId uuid.UUID) ([]model.Folder
 	var folders []model.Folder
 
 	if err := f.database.Connection().
+		Preload("Tags").
 		Where("user_id = ?", userId).
 		Order("id DESC").
 		Find(&folders).
@@ -63,6 +65,7 @@ func (f *folderRepository) FindFoldersByParentId(userId uuid.UUID, parentId uuid
 	var folders []model.Folder
 
 	if err := f.database.Connection().
+		Preload("Tags").
 		Where("user_id = ? AND parent_id = ?", userId, parentId).
 		Order("id DESC").
 		Find(&folders).
@@ -84,6 +87,15 @@ func (f *folderRepository) FindFolderById(id uuid.UUID) (model.Folder, error) {
 	return folder, nil
 }
 
+// FindFoldersByIds implements FolderRepositoryInterface.
+func (f *folderRepository) FindFoldersByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.Folder, error) {
+	var folders []model.Folder
+
+	err := f.database.Connection().Where("user_id = ? AND id IN ?", userId, ids).Find(&folders).Error
+
+	return folders, err
+}
+
 // UpdateFolder implements FolderRepositoryInterface.
 func (f *folderRepository) UpdateFolder(folder model.Folder) (model.Folder, error) {
 
@@ -0,0 +1,122 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type PermissionRepositoryInterface interface {
+	CreatePermission(permission model.Permission) (model.Permission, error)
+	FindPermissionById(id uuid.UUID) (model.Permission, error)
+	FindPermission(userId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) (model.Permission, error)
+	FindPermissionsByItem(fileId *uuid.UUID, folderId *uuid.UUID) ([]model.Permission, error)
+	FindPermissionsFromOwner(ownerId uuid.UUID, userId uuid.UUID) ([]model.Permission, error)
+	FindPermissionsByUserId(userId uuid.UUID) ([]model.Permission, error)
+	UpdatePermissionRole(id uuid.UUID, role string) error
+	DeletePermission(id uuid.UUID) error
+}
+
+type permissionRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewPermissionRepository(database database.DatabaseInterface) PermissionRepositoryInterface {
+	return &permissionRepository{database: database}
+}
+
+// CreatePermission implements PermissionRepositoryInterface.
+func (p *permissionRepository) CreatePermission(permission model.Permission) (model.Permission, error) {
+	permission.Prepare()
+
+	if err := p.database.Connection().Create(&permission).Error; err != nil {
+		return model.Permission{}, err
+	}
+
+	return permission, nil
+}
+
+// FindPermissionById implements PermissionRepositoryInterface.
+func (p *permissionRepository) FindPermissionById(id uuid.UUID) (model.Permission, error) {
+	var permission model.Permission
+
+	err := p.database.Connection().Preload("User").Where("id = ?", id).First(&permission).Error
+
+	return permission, err
+}
+
+// FindPermission returns the permission the user has on exactly the file or folder, not one inherited
+// from a folder above it
+func (p *permissionRepository) FindPermission(userId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) (model.Permission, error) {
+	var permission model.Permission
+
+	query := p.database.Connection().Preload("User").Where("user_id = ?", userId)
+	if fileId != nil {
+		query = query.Where("file_id = ?", *fileId)
+	} else {
+		query = query.Where("folder_id = ?", *folderId)
+	}
+
+	err := query.First(&permission).Error
+
+	return permission, err
+}
+
+// FindPermissionsByItem lists who the file or folder is shared with, oldest first
+func (p *permissionRepository) FindPermissionsByItem(fileId *uuid.UUID, folderId *uuid.UUID) ([]model.Permission, error) {
+	var permissions []model.Permission
+
+	query := p.database.Connection().Preload("User")
+	if fileId != nil {
+		query = query.Where("file_id = ?", *fileId)
+	} else {
+		query = query.Where("folder_id = ?", *folderId)
+	}
+
+	err := query.Order("created_at ASC").Find(&permissions).Error
+
+	return permissions, err
+}
+
+// FindPermissionsFromOwner returns every permission the user has on the owner's files and folders
+func (p *permissionRepository) FindPermissionsFromOwner(ownerId uuid.UUID, userId uuid.UUID) ([]model.Permission, error) {
+	var permissions []model.Permission
+
+	err := p.database.Connection().Where("owner_id = ? AND user_id = ?", ownerId, userId).Find(&permissions).Error
+
+	return permissions, err
+}
+
+// FindPermissionsByUserId returns what was shared with the user along with the items and their owners,
+// newest first. Items that were deleted are left unset.
+func (p *permissionRepository) FindPermissionsByUserId(userId uuid.UUID) ([]model.Permission, error) {
+	var permissions []model.Permission
+
+	err := p.database.Connection().
+		Preload("Owner").
+		Preload("File.Blob").
+		Preload("Folder").
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Find(&permissions).
+		Error
+
+	return permissions, err
+}
+
+// UpdatePermissionRole implements PermissionRepositoryInterface.
+func (p *permissionRepository) UpdatePermissionRole(id uuid.UUID, role string) error {
+	return p.database.Connection().
+		Model(&model.Permission{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"role": role, "updated_at": time.Now()}).
+		Error
+}
+
+// DeletePermission removes a permission for good
+func (p *permissionRepository) DeletePermission(id uuid.UUID) error {
+	return p.database.Connection().Unscoped().Delete(&model.Permission{}, "id = ?", id).Error
+}
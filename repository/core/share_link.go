@@ -0,0 +1,86 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type ShareLinkRepositoryInterface interface {
+	CreateShareLink(link model.ShareLink) (model.ShareLink, error)
+	FindShareLinkById(id uuid.UUID) (model.ShareLink, error)
+	FindShareLinkByToken(token string) (model.ShareLink, error)
+	FindShareLinksByUserId(userId uuid.UUID) ([]model.ShareLink, error)
+	RevokeShareLink(id uuid.UUID) error
+	CountDownload(id uuid.UUID) (bool, error)
+}
+
+type shareLinkRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewShareLinkRepository(database database.DatabaseInterface) ShareLinkRepositoryInterface {
+	return &shareLinkRepository{database: database}
+}
+
+// CreateShareLink implements ShareLinkRepositoryInterface.
+func (s *shareLinkRepository) CreateShareLink(link model.ShareLink) (model.ShareLink, error) {
+	link.Prepare()
+
+	if err := s.database.Connection().Create(&link).Error; err != nil {
+		return model.ShareLink{}, err
+	}
+
+	return link, nil
+}
+
+// FindShareLinkById implements ShareLinkRepositoryInterface.
+func (s *shareLinkRepository) FindShareLinkById(id uuid.UUID) (model.ShareLink, error) {
+	var link model.ShareLink
+
+	err := s.database.Connection().Where("id = ?", id).First(&link).Error
+
+	return link, err
+}
+
+// FindShareLinkByToken implements ShareLinkRepositoryInterface.
+func (s *shareLinkRepository) FindShareLinkByToken(token string) (model.ShareLink, error) {
+	var link model.ShareLink
+
+	err := s.database.Connection().Where("token = ?", token).First(&link).Error
+
+	return link, err
+}
+
+// FindShareLinksByUserId returns the user's share links, newest first
+func (s *shareLinkRepository) FindShareLinksByUserId(userId uuid.UUID) ([]model.ShareLink, error) {
+	var links []model.ShareLink
+
+	err := s.database.Connection().Where("user_id = ?", userId).Order("created_at DESC").Find(&links).Error
+
+	return links, err
+}
+
+// RevokeShareLink stops a link from working, it is kept so its owner can still see it
+func (s *shareLinkRepository) RevokeShareLink(id uuid.UUID) error {
+	return s.database.Connection().
+		Model(&model.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "updated_at": time.Now()}).
+		Error
+}
+
+// CountDownload adds a download to the link unless that would go over its limit, in which case it
+// returns false
+func (s *shareLinkRepository) CountDownload(id uuid.UUID) (bool, error) {
+	result := s.database.Connection().
+		Model(&model.ShareLink{}).
+		Where("id = ? AND (max_downloads IS NULL OR downloads < max_downloads)", id).
+		Update("downloads", gorm.Expr("downloads + 1"))
+
+	return result.RowsAffected > 0, result.Error
+}
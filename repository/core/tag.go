@@ -0,0 +1,161 @@
+package core_repository
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type TagRepositoryInterface interface {
+	CreateTag(tag model.Tag) (model.Tag, error)
+	FindTagsByUserId(userId uuid.UUID) ([]model.Tag, error)
+	FindTagsByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.Tag, error)
+	FindTagById(id uuid.UUID) (model.Tag, error)
+	FindTagByName(userId uuid.UUID, name string) (model.Tag, error)
+	UpdateTag(tag model.Tag) (model.Tag, error)
+	DeleteTag(id uuid.UUID) error
+	AttachTags(tagIds []uuid.UUID, fileIds []uuid.UUID, folderIds []uuid.UUID) error
+	DetachTags(tagIds []uuid.UUID, fileIds []uuid.UUID, folderIds []uuid.UUID) error
+}
+
+// fileTag and folderTag are rows of the join tables behind File.Tags and Folder.Tags
+type fileTag struct {
+	FileID uuid.UUID
+	TagID  uuid.UUID
+}
+
+func (fileTag) TableName() string {
+	return "file_tags"
+}
+
+type folderTag struct {
+	FolderID uuid.UUID
+	TagID    uuid.UUID
+}
+
+func (folderTag) TableName() string {
+	return "folder_tags"
+}
+
+type tagRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewTagRepository(database database.DatabaseInterface) TagRepositoryInterface {
+	return &tagRepository{database: database}
+}
+
+// CreateTag implements TagRepositoryInterface.
+func (r *tagRepository) CreateTag(tag model.Tag) (model.Tag, error) {
+	tag.Prepare()
+
+	if err := r.database.Connection().Create(&tag).Error; err != nil {
+		return model.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+// FindTagsByUserId implements TagRepositoryInterface.
+func (r *tagRepository) FindTagsByUserId(userId uuid.UUID) ([]model.Tag, error) {
+	var tags []model.Tag
+
+	err := r.database.Connection().Where("user_id = ?", userId).Order("name").Find(&tags).Error
+
+	return tags, err
+}
+
+// FindTagsByIds implements TagRepositoryInterface.
+func (r *tagRepository) FindTagsByIds(userId uuid.UUID, ids []uuid.UUID) ([]model.Tag, error) {
+	var tags []model.Tag
+
+	err := r.database.Connection().Where("user_id = ? AND id IN ?", userId, ids).Find(&tags).Error
+
+	return tags, err
+}
+
+// FindTagById implements TagRepositoryInterface.
+func (r *tagRepository) FindTagById(id uuid.UUID) (model.Tag, error) {
+	var tag model.Tag
+
+	err := r.database.Connection().Where("id = ?", id).First(&tag).Error
+
+	return tag, err
+}
+
+// FindTagByName looks up one of the user's tags by its name, ignoring case
+func (r *tagRepository) FindTagByName(userId uuid.UUID, name string) (model.Tag, error) {
+	var tag model.Tag
+
+	err := r.database.Connection().Where("user_id = ? AND LOWER(name) = LOWER(?)", userId, name).First(&tag).Error
+
+	return tag, err
+}
+
+// UpdateTag implements TagRepositoryInterface.
+func (r *tagRepository) UpdateTag(tag model.Tag) (model.Tag, error) {
+	if err := r.database.Connection().Save(&tag).Error; err != nil {
+		return model.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+// DeleteTag removes a tag for good, the join tables drop its attachments
+func (r *tagRepository) DeleteTag(id uuid.UUID) error {
+	return r.database.Connection().Unscoped().Delete(&model.Tag{}, "id = ?", id).Error
+}
+
+// AttachTags attaches every tag to every file and folder, attachments that already exist are kept
+func (r *tagRepository) AttachTags(tagIds []uuid.UUID, fileIds []uuid.UUID, folderIds []uuid.UUID) error {
+	fileTags := []fileTag{}
+	folderTags := []folderTag{}
+
+	for _, tagId := range tagIds {
+		for _, fileId := range fileIds {
+			fileTags = append(fileTags, fileTag{FileID: fileId, TagID: tagId})
+		}
+
+		for _, folderId := range folderIds {
+			folderTags = append(folderTags, folderTag{FolderID: folderId, TagID: tagId})
+		}
+	}
+
+	return r.database.Connection().Transaction(func(tx *gorm.DB) error {
+		if len(fileTags) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fileTags).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(folderTags) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&folderTags).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DetachTags removes every tag from every file and folder
+func (r *tagRepository) DetachTags(tagIds []uuid.UUID, fileIds []uuid.UUID, folderIds []uuid.UUID) error {
+	return r.database.Connection().Transaction(func(tx *gorm.DB) error {
+		if len(fileIds) > 0 {
+			if err := tx.Where("tag_id IN ? AND file_id IN ?", tagIds, fileIds).Delete(&fileTag{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(folderIds) > 0 {
+			if err := tx.Where("tag_id IN ? AND folder_id IN ?", tagIds, folderIds).Delete(&folderTag{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type UploadRepositoryInterface interface {
+	CreateSession(session model.UploadSession) (model.UploadSession, error)
+	FindSessionById(id uuid.UUID) (model.UploadSession, error)
+	FindExpiredSessions(before time.Time) ([]model.UploadSession, error)
+	CompleteSession(id uuid.UUID, fileId uuid.UUID) error
+	DeleteSession(id uuid.UUID) error
+	AppendChunk(chunk model.UploadChunk) (bool, error)
+	FindChunksBySessionId(sessionId uuid.UUID) ([]model.UploadChunk, error)
+	DeleteChunksBySessionId(sessionId uuid.UUID) error
+}
+
+type uploadRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewUploadRepository(database database.DatabaseInterface) UploadRepositoryInterface {
+	return &uploadRepository{database: database}
+}
+
+// CreateSession implements UploadRepositoryInterface.
+func (u *uploadRepository) CreateSession(session model.UploadSession) (model.UploadSession, error) {
+	session.Prepare()
+
+	if err := u.database.Connection().Create(&session).Error; err != nil {
+		return model.UploadSession{}, err
+	}
+
+	return session, nil
+}
+
+// FindSessionById implements UploadRepositoryInterface.
+func (u *uploadRepository) FindSessionById(id uuid.UUID) (model.UploadSession, error) {
+	var session model.UploadSession
+
+	err := u.database.Connection().Where("id = ?", id).First(&session).Error
+
+	return session, err
+}
+
+// FindExpiredSessions implements UploadRepositoryInterface.
+func (u *uploadRepository) FindExpiredSessions(before time.Time) ([]model.UploadSession, error) {
+	var sessions []model.UploadSession
+
+	err := u.database.Connection().
+		Where("file_id IS NULL AND expires_at < ?", before).
+		Find(&sessions).
+		Error
+
+	return sessions, err
+}
+
+// CompleteSession implements UploadRepositoryInterface.
+func (u *uploadRepository) CompleteSession(id uuid.UUID, fileId uuid.UUID) error {
+	return u.database.Connection().
+		Model(&model.UploadSession{}).
+		Where("id = ?", id).
+		Update("file_id", fileId).
+		Error
+}
+
+// DeleteSession implements UploadRepositoryInterface.
+func (u *uploadRepository) DeleteSession(id uuid.UUID) error {
+	return u.database.Connection().Unscoped().Delete(&model.UploadSession{}, "id = ?", id).Error
+}
+
+// AppendChunk records a chunk and advances the session offset past it. It returns false
+// without recording anything when the session is no longer at the chunk's start offset.
+func (u *uploadRepository) AppendChunk(chunk model.UploadChunk) (bool, error) {
+	appended := false
+
+	err := u.database.Connection().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.UploadSession{}).
+			Where("id = ? AND upload_offset = ?", chunk.UploadSessionID, chunk.StartOffset).
+			Update("upload_offset", chunk.StartOffset+chunk.Size)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		chunk.Prepare()
+		if err := tx.Create(&chunk).Error; err != nil {
+			return err
+		}
+
+		appended = true
+
+		return nil
+	})
+
+	return appended, err
+}
+
+// FindChunksBySessionId implements UploadRepositoryInterface.
+func (u *uploadRepository) FindChunksBySessionId(sessionId uuid.UUID) ([]model.UploadChunk, error) {
+	var chunks []model.UploadChunk
+
+	err := u.database.Connection().
+		Where("upload_session_id = ?", sessionId).
+		Order("start_offset ASC").
+		Find(&chunks).
+		Error
+
+	return chunks, err
+}
+
+// DeleteChunksBySessionId implements UploadRepositoryInterface.
+func (u *uploadRepository) DeleteChunksBySessionId(sessionId uuid.UUID) error {
+	return u.database.Connection().Unscoped().Delete(&model.UploadChunk{}, "upload_session_id = ?", sessionId).Error
+}
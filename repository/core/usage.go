@@ -0,0 +1,58 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type StorageUsageRepositoryInterface interface {
+	FindUsageByUserId(userId uuid.UUID) (model.StorageUsage, error)
+	CountFiles(userId uuid.UUID) (int64, error)
+}
+
+type storageUsageRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewStorageUsageRepository(database database.DatabaseInterface) StorageUsageRepositoryInterface {
+	return &storageUsageRepository{database: database}
+}
+
+// FindUsageByUserId returns the user's usage, a user who never stored anything uses 0 bytes
+func (s *storageUsageRepository) FindUsageByUserId(userId uuid.UUID) (model.StorageUsage, error) {
+	var usage model.StorageUsage
+
+	err := s.database.Connection().Where("user_id = ?", userId).First(&usage).Error
+	if err == gorm.ErrRecordNotFound {
+		return model.StorageUsage{UserID: userId}, nil
+	}
+
+	return usage, err
+}
+
+// CountFiles counts the user's files outside the trash
+func (s *storageUsageRepository) CountFiles(userId uuid.UUID) (int64, error) {
+	var count int64
+
+	err := s.database.Connection().Model(&model.File{}).Where("user_id = ?", userId).Count(&count).Error
+
+	return count, err
+}
+
+// addStorageUsage moves the user's usage by delta bytes as part of tx
+func addStorageUsage(tx *gorm.DB, userId uuid.UUID, delta int64) error {
+	var usage model.StorageUsage
+	usage.Prepare()
+
+	return tx.Exec(`
+		INSERT INTO storage_usages (id, created_at, updated_at, user_id, bytes_used)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET bytes_used = storage_usages.bytes_used + EXCLUDED.bytes_used, updated_at = EXCLUDED.updated_at`,
+		usage.ID, time.Now(), time.Now(), userId, delta,
+	).Error
+}
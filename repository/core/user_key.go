@@ -0,0 +1,79 @@
+package core_repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+)
+
+type UserKeyRepositoryInterface interface {
+	FindUserKey(userId uuid.UUID) (model.UserKey, error)
+	CreateUserKey(key model.UserKey) (model.UserKey, error)
+	FindUserKeysNotWrappedBy(masterKeyId string, limit int) ([]model.UserKey, error)
+	RewrapUserKey(id uuid.UUID, fromMasterKeyId string, toMasterKeyId string, wrappedKey []byte) (bool, error)
+}
+
+type userKeyRepository struct {
+	database database.DatabaseInterface
+}
+
+func NewUserKeyRepository(database database.DatabaseInterface) UserKeyRepositoryInterface {
+	return &userKeyRepository{database: database}
+}
+
+// FindUserKey implements UserKeyRepositoryInterface.
+func (u *userKeyRepository) FindUserKey(userId uuid.UUID) (model.UserKey, error) {
+	var key model.UserKey
+
+	err := u.database.Connection().Where("user_id = ?", userId).First(&key).Error
+
+	return key, err
+}
+
+// CreateUserKey stores the user's key unless another request stored one first, and returns the one that is kept
+func (u *userKeyRepository) CreateUserKey(key model.UserKey) (model.UserKey, error) {
+	key.Prepare()
+
+	err := u.database.Connection().Exec(`
+		INSERT INTO user_keys (id, created_at, updated_at, user_id, master_key_id, wrapped_key)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO NOTHING`,
+		key.ID, time.Now(), time.Now(), key.UserID, key.MasterKeyID, key.WrappedKey,
+	).Error
+	if err != nil {
+		return model.UserKey{}, err
+	}
+
+	return u.FindUserKey(key.UserID)
+}
+
+// FindUserKeysNotWrappedBy returns keys still wrapped by another master key than the given one
+func (u *userKeyRepository) FindUserKeysNotWrappedBy(masterKeyId string, limit int) ([]model.UserKey, error) {
+	var keys []model.UserKey
+
+	err := u.database.Connection().
+		Where("master_key_id <> ?", masterKeyId).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&keys).
+		Error
+
+	return keys, err
+}
+
+// RewrapUserKey replaces the wrapping of a key if it is still wrapped by fromMasterKeyId and reports whether it was
+func (u *userKeyRepository) RewrapUserKey(id uuid.UUID, fromMasterKeyId string, toMasterKeyId string, wrappedKey []byte) (bool, error) {
+	result := u.database.Connection().
+		Model(&model.UserKey{}).
+		Where("id = ? AND master_key_id = ?", id, fromMasterKeyId).
+		Updates(map[string]interface{}{
+			"master_key_id": toMasterKeyId,
+			"wrapped_key":   wrappedKey,
+			"updated_at":    time.Now(),
+		})
+
+	return result.RowsAffected > 0, result.Error
+}
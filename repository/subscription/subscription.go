@@ -189,6 +189,11 @@ func (r *subscriptionRepository) planToDTO(plan *model.SubscriptionPlan) dto.Sub
 		IsActive:    plan.IsActive,
 		CreatedAt:   plan.CreatedAt,
 		UpdatedAt:   plan.UpdatedAt,
+
+		MaxUploadSize:   plan.MaxUploadSize,
+		MaxFileVersions: plan.MaxFileVersions,
+		StorageQuota:    plan.StorageQuota,
+		MaxArchiveSize:  plan.MaxArchiveSize,
 	}
 }
 
@@ -1,53 +1,204 @@
 package router
 
 import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 
 	core_handler "github.com/shordem/api.thryvo/handler/core"
 	"github.com/shordem/api.thryvo/lib/config"
 	"github.com/shordem/api.thryvo/lib/constants"
 	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/lib/scheduler"
 	"github.com/shordem/api.thryvo/middleware"
 	core_repository "github.com/shordem/api.thryvo/repository/core"
 	user_repository "github.com/shordem/api.thryvo/repository/user"
+	"github.com/shordem/api.thryvo/service"
 	core_service "github.com/shordem/api.thryvo/service/core"
+	user_service "github.com/shordem/api.thryvo/service/user"
 )
 
-func InitializeCoreRouter(router fiber.Router, db database.DatabaseInterface, env constants.Env) {
+func InitializeCoreRouter(router fiber.Router, db database.DatabaseInterface, env constants.Env, planLimits middleware.PlanLimitChecker) {
 	// config
 	fileConfig := config.NewFileConfig(env)
+	scanner := config.NewScanner(env)
+	urlSigner := helper.NewURLSigner(env.FILE_URL_SECRET)
+	mailConfig := config.NewEmail(env)
+
+	if days, err := strconv.Atoi(env.TRASH_RETENTION_DAYS); err == nil && days > 0 {
+		core_service.TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	// the scheduled reconciliation only reports differences unless repairs are switched on
+	reconcileRepair, _ := strconv.ParseBool(env.STORAGE_RECONCILE_REPAIR)
+
+	masterKeyId, masterKeys, err := core_service.ParseMasterKeys(env.ENCRYPTION_MASTER_KEYS)
+	if err != nil {
+		log.Fatal("ENCRYPTION_MASTER_KEYS: ", err)
+	}
+
+	if env.MIME_MISMATCH_POLICY == core_service.ContentTypeMismatchReject {
+		core_service.ContentTypeMismatchPolicy = core_service.ContentTypeMismatchReject
+	}
+
+	if env.SCAN_FAILURE_POLICY == core_service.ScanFailureQuarantine {
+		core_service.ScanFailurePolicy = core_service.ScanFailureQuarantine
+	}
 
 	// repository
 	fileRepository := core_repository.NewFileRepository(db)
 	folderRepository := core_repository.NewFolderRepository(db)
+	blobRepository := core_repository.NewBlobRepository(db)
+	fileVersionRepository := core_repository.NewFileVersionRepository(db)
+	uploadRepository := core_repository.NewUploadRepository(db)
+	directUploadRepository := core_repository.NewDirectUploadRepository(db)
+	contentTypeRuleRepository := core_repository.NewContentTypeRuleRepository(db)
+	storageUsageRepository := core_repository.NewStorageUsageRepository(db)
+	tagRepository := core_repository.NewTagRepository(db)
+	userKeyRepository := core_repository.NewUserKeyRepository(db)
+	shareLinkRepository := core_repository.NewShareLinkRepository(db)
+	permissionRepository := core_repository.NewPermissionRepository(db)
 	userRepository := user_repository.NewUserRepository(db)
 
 	// service
-	fileService := core_service.NewFileService(fileConfig, fileRepository, folderRepository, userRepository)
-	folderService := core_service.NewFolderService(folderRepository, userRepository)
+	emailService := service.NewEmailService(mailConfig, db.Cache())
+	contentTypeService := core_service.NewContentTypeService(contentTypeRuleRepository)
+	usageService := core_service.NewStorageUsageService(storageUsageRepository, planLimits)
+	encryptionService := core_service.NewEncryptionService(userKeyRepository, masterKeyId, masterKeys)
+	permissionService := core_service.NewPermissionService(permissionRepository, fileRepository, folderRepository, userRepository, fileConfig, emailService)
+	fileService := core_service.NewFileService(fileConfig, fileRepository, folderRepository, blobRepository, fileVersionRepository, userRepository, contentTypeService, usageService, urlSigner, planLimits, encryptionService, permissionService)
+	folderService := core_service.NewFolderService(folderRepository, userRepository, permissionService)
+	tagService := core_service.NewTagService(tagRepository, fileRepository, folderRepository)
+	shareService := core_service.NewShareService(shareLinkRepository, fileRepository, folderRepository, fileService, helper.NewHashing())
+	uploadService := core_service.NewUploadService(fileConfig, uploadRepository, folderRepository, fileService, usageService, planLimits, permissionService)
+	malwareScanService := core_service.NewMalwareScanService(scanner, fileConfig, blobRepository, fileRepository, userRepository, encryptionService, emailService)
+	fileExpiryNotifier := core_service.NewFileExpiryNotifier(fileRepository, userRepository, emailService)
+	directUploadService := core_service.NewDirectUploadService(fileConfig, directUploadRepository, folderRepository, fileService, contentTypeService, usageService, planLimits, permissionService)
 
 	// handler
 	fileHandler := core_handler.NewFileHandler(fileService)
 	folderHandler := core_handler.NewFolderHandler(folderService)
+	uploadHandler := core_handler.NewUploadHandler(uploadService)
+	directUploadHandler := core_handler.NewDirectUploadHandler(directUploadService)
+	contentTypeHandler := core_handler.NewContentTypeHandler(contentTypeService)
+	usageHandler := core_handler.NewUsageHandler(usageService)
+	tagHandler := core_handler.NewTagHandler(tagService)
+	shareHandler := core_handler.NewShareHandler(shareService)
+	permissionHandler := core_handler.NewPermissionHandler(permissionService)
 
 	// Middlewares
 	authMiddleware := middleware.Protected()
 	apiKeyMiddleware := middleware.RequireAPIKey(db)
+	uploadLimitMiddleware := middleware.UploadLimit(planLimits)
+	batchUploadLimitMiddleware := middleware.BatchUploadLimit(planLimits, core_service.MaxBatchFiles)
+	keyOrAuthMiddleware := middleware.ProtectedOrAPIKey(db)
+	optionalAuthMiddleware := middleware.OptionalAuth(db)
+	adminMiddleware := middleware.NewRoleMiddleware(userRepository).ValidateRole(user_service.UserRoleAdmin)
 
 	// hot fix for upload server
-	router.Post("/files", apiKeyMiddleware, fileHandler.UploadFile)
+	router.Post("/files", apiKeyMiddleware, uploadLimitMiddleware, fileHandler.UploadFile)
+
+	router.Get("/user/usage", keyOrAuthMiddleware, usageHandler.GetUsage)
+	router.Get("/shared-with-me", keyOrAuthMiddleware, permissionHandler.GetSharedWithMe)
+	router.Post("/storage/reconcile", authMiddleware, adminMiddleware, fileHandler.ReconcileStorage)
+	router.Get("/storage/quarantine", authMiddleware, adminMiddleware, fileHandler.GetQuarantinedFiles)
 
 	// Base routes
 	fileRouter := router.Group("/file")
 	folderRouter := router.Group("/folder")
+	uploadRouter := router.Group("/upload", uploadHandler.TusResumable)
+	contentTypeRouter := router.Group("/content-types", authMiddleware)
+	tagRouter := router.Group("/tags", keyOrAuthMiddleware)
+	shareLinkRouter := router.Group("/shares", keyOrAuthMiddleware)
+	shareRouter := router.Group("/share")
+	permissionRouter := router.Group("/permissions", keyOrAuthMiddleware)
 
-	fileRouter.Post("/upload", apiKeyMiddleware, fileHandler.UploadFile)
+	fileRouter.Post("/upload", apiKeyMiddleware, uploadLimitMiddleware, fileHandler.UploadFile)
+	fileRouter.Post("/upload/batch", keyOrAuthMiddleware, batchUploadLimitMiddleware, fileHandler.UploadFiles)
+	fileRouter.Post("/presign", keyOrAuthMiddleware, directUploadHandler.CreateDirectUpload)
+	fileRouter.Post("/presign/:id/finalize", keyOrAuthMiddleware, directUploadHandler.FinalizeDirectUpload)
 	fileRouter.Get("/", authMiddleware, fileHandler.GetUserFiles)
-	fileRouter.Get("/:user_id/:key", fileHandler.GetFile)
+	fileRouter.Get("/trash", keyOrAuthMiddleware, fileHandler.GetTrashedFiles)
+	fileRouter.Delete("/trash/:id", keyOrAuthMiddleware, fileHandler.PurgeFile)
+	fileRouter.Post("/move", keyOrAuthMiddleware, fileHandler.MoveFiles)
+	fileRouter.Post("/archive", keyOrAuthMiddleware, fileHandler.DownloadFiles)
+	fileRouter.Patch("/:id", keyOrAuthMiddleware, fileHandler.UpdateFile)
+	fileRouter.Patch("/:id/metadata", keyOrAuthMiddleware, fileHandler.UpdateMetadata)
+	fileRouter.Put("/:id/expiry", keyOrAuthMiddleware, fileHandler.SetExpiry)
+	fileRouter.Delete("/:id", keyOrAuthMiddleware, fileHandler.DeleteFile)
+	fileRouter.Post("/:id/restore", keyOrAuthMiddleware, fileHandler.RestoreFile)
+	fileRouter.Post("/:id/signed-url", keyOrAuthMiddleware, fileHandler.CreateSignedURL)
+	fileRouter.Post("/:id/versions", keyOrAuthMiddleware, uploadLimitMiddleware, fileHandler.UploadVersion)
+	fileRouter.Get("/:id/versions", keyOrAuthMiddleware, fileHandler.GetFileVersions)
+	fileRouter.Post("/:id/versions/:version/restore", keyOrAuthMiddleware, fileHandler.RestoreVersion)
+	fileRouter.Get("/:user_id/:key", optionalAuthMiddleware, fileHandler.GetFile)
+
+	tagRouter.Get("/", tagHandler.GetTags)
+	tagRouter.Post("/", tagHandler.CreateTag)
+	tagRouter.Post("/attach", tagHandler.TagItems)
+	tagRouter.Post("/detach", tagHandler.UntagItems)
+	tagRouter.Patch("/:id", tagHandler.UpdateTag)
+	tagRouter.Delete("/:id", tagHandler.DeleteTag)
+
+	shareLinkRouter.Get("/", shareHandler.GetShareLinks)
+	shareLinkRouter.Post("/", shareHandler.CreateShareLink)
+	shareLinkRouter.Delete("/:id", shareHandler.RevokeShareLink)
+
+	permissionRouter.Get("/", permissionHandler.GetPermissions)
+	permissionRouter.Post("/", permissionHandler.GrantPermission)
+	permissionRouter.Patch("/:id", permissionHandler.UpdatePermission)
+	permissionRouter.Delete("/:id", permissionHandler.RevokePermission)
+
+	// public, the token is the credential
+	shareRouter.Get("/:token", shareHandler.ResolveShareLink)
+	shareRouter.Get("/:token/download", shareHandler.GetSharedFile)
+
+	// resumable uploads (tus)
+	uploadRouter.Options("/", uploadHandler.Options)
+	uploadRouter.Post("/", keyOrAuthMiddleware, uploadHandler.CreateUpload)
+	uploadRouter.Head("/:id", keyOrAuthMiddleware, uploadHandler.GetUploadOffset)
+	uploadRouter.Patch("/:id", keyOrAuthMiddleware, uploadHandler.PatchUpload)
+	uploadRouter.Delete("/:id", keyOrAuthMiddleware, uploadHandler.TerminateUpload)
 
 	folderRouter.Post("/", authMiddleware, folderHandler.CreateFolder)
 	folderRouter.Get("/", authMiddleware, folderHandler.GetUserFolders)
 	folderRouter.Get("/:parent_id", authMiddleware, folderHandler.GetFoldersByParent)
+	folderRouter.Get("/:id/archive", keyOrAuthMiddleware, fileHandler.DownloadFolder)
 	folderRouter.Put("/:id", authMiddleware, folderHandler.UpdateFolder)
 	folderRouter.Delete("/:id", authMiddleware, folderHandler.DeleteFolder)
+
+	contentTypeRouter.Get("/allowed", contentTypeHandler.GetAllowedTypes)
+	contentTypeRouter.Post("/allowed", contentTypeHandler.AllowType)
+	contentTypeRouter.Delete("/allowed/:id", contentTypeHandler.RemoveAllowedType)
+	contentTypeRouter.Get("/blocked", adminMiddleware, contentTypeHandler.GetBlockedTypes)
+	contentTypeRouter.Post("/blocked", adminMiddleware, contentTypeHandler.BlockType)
+	contentTypeRouter.Delete("/blocked/:id", adminMiddleware, contentTypeHandler.UnblockType)
+
+	// Background jobs
+	scheduler.Every("expired upload cleanup", time.Hour, uploadService.CleanupExpiredUploads)
+	scheduler.Every("unfinalized direct upload cleanup", 15*time.Minute, directUploadService.CleanupExpiredDirectUploads)
+	scheduler.Every("trash purge", time.Hour, fileService.PurgeTrash)
+	scheduler.Every("expired file purge", 15*time.Minute, fileService.PurgeExpiredFiles)
+	scheduler.Every("file expiry warnings", 30*time.Minute, fileExpiryNotifier.WarnExpiringFiles)
+	scheduler.Every("pending file processing", time.Minute, fileService.ProcessPendingFiles)
+	scheduler.Every("malware scan", time.Minute, malwareScanService.ScanPendingContent)
+	scheduler.Every("master key rotation", time.Hour, encryptionService.RotateMasterKey)
+	scheduler.Every("storage reconciliation", 24*time.Hour, func(ctx context.Context) error {
+		report, err := fileService.ReconcileStorage(ctx, !reconcileRepair)
+		if err != nil {
+			return err
+		}
+
+		log.Printf(
+			"storage reconciliation (dry run: %t): %d users, %d objects scanned, %d orphaned objects (%d bytes, %d deleted), %d dangling files (%d purged), %d errors",
+			report.DryRun, report.UsersScanned, report.ObjectsScanned, report.OrphanedObjects, report.OrphanedBytes,
+			report.ObjectsDeleted, report.DanglingFiles, report.FilesPurged, len(report.Errors),
+		)
+
+		return nil
+	})
 }
@@ -44,7 +44,7 @@ func InitializeRouter(router *fiber.App, dbConn database.DatabaseInterface, env
 	subAdapter := &subscriptionAdapter{subService: subscriptionService}
 
 	InitializeUserRouter(main, dbConn, env, subAdapter)
-	InitializeCoreRouter(main, dbConn, env)
+	InitializeCoreRouter(main, dbConn, env, subscriptionService)
 
 	router.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("OK")
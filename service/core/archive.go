@@ -0,0 +1,261 @@
+package core_service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+)
+
+var (
+	// MaxArchiveFiles caps how many files one archive download can hold
+	MaxArchiveFiles = 10_000
+	// SelectionArchiveName is the name archives of a selection of files are offered under
+	SelectionArchiveName = "files.zip"
+)
+
+var (
+	ErrArchiveTooLarge     = errors.New("the files are larger than the archive download limit of your plan")
+	ErrTooManyArchiveFiles = fmt.Errorf("at most %d files can be downloaded in one archive", MaxArchiveFiles)
+)
+
+// ArchiveInterface is a ZIP archive whose entries are resolved and checked against the user's limits,
+// its content is only read from storage while it is written
+type ArchiveInterface interface {
+	// Name is the file name the archive is offered under
+	Name() string
+	// Write streams the archive to w, it stops at the first storage failure
+	Write(w io.Writer) error
+}
+
+// archiveEntry is a file, or a folder when file is nil, at a slash separated path inside the archive
+type archiveEntry struct {
+	name     string
+	modified time.Time
+	file     *model.File
+}
+
+type archive struct {
+	fileService *fileService
+	name        string
+	entries     []archiveEntry
+}
+
+// ArchiveFolder prepares an archive of everything in a folder the user can view and its subfolders.
+// The folder's content is at the root of the archive.
+func (f *fileService) ArchiveFolder(userId uuid.UUID, folderId uuid.UUID) (ArchiveInterface, error) {
+	folder, err := findFolder(f.folderRepository, f.permissions, folderId, userId, PermissionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := f.folderRepository.FindFoldersByUserId(folder.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[uuid.UUID][]model.Folder{}
+	for _, child := range folders {
+		if child.ParentID != nil {
+			children[*child.ParentID] = append(children[*child.ParentID], child)
+		}
+	}
+
+	// paths of the folders in the tree, walked breadth first so a broken parent chain can't loop
+	paths := map[uuid.UUID]string{folder.ID: ""}
+	taken := map[string]map[string]bool{"": {}}
+	folderIds := []uuid.UUID{folder.ID}
+	entries := []archiveEntry{}
+
+	for i := 0; i < len(folderIds); i++ {
+		parentPath := paths[folderIds[i]]
+
+		for _, child := range children[folderIds[i]] {
+			if _, seen := paths[child.ID]; seen {
+				continue
+			}
+
+			path := parentPath + claimName(archiveName(child.Name), taken[parentPath]) + "/"
+			taken[path] = map[string]bool{}
+
+			paths[child.ID] = path
+			folderIds = append(folderIds, child.ID)
+			entries = append(entries, archiveEntry{name: path, modified: child.UpdatedAt})
+		}
+	}
+
+	files, err := f.fileRepository.FindFilesInFolders(folder.UserID, folderIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) > MaxArchiveFiles {
+		return nil, ErrTooManyArchiveFiles
+	}
+
+	for i := range files {
+		dir := paths[*files[i].FolderID]
+		name := dir + claimName(archiveName(files[i].OriginalName), taken[dir])
+
+		entries = append(entries, archiveEntry{name: name, modified: files[i].UpdatedAt, file: &files[i]})
+	}
+
+	return f.newArchive(userId, archiveName(folder.Name)+".zip", entries)
+}
+
+// ArchiveFiles prepares an archive of a selection of files the user can view, side by side at its root
+func (f *fileService) ArchiveFiles(userId uuid.UUID, ids []uuid.UUID) (ArchiveInterface, error) {
+	if len(ids) == 0 {
+		return nil, ErrNoFilesSelected
+	}
+
+	ids = uniqueIds(ids)
+
+	if len(ids) > MaxArchiveFiles {
+		return nil, ErrTooManyArchiveFiles
+	}
+
+	files, err := f.findFiles(userId, ids, PermissionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].OriginalName < files[j].OriginalName
+	})
+
+	taken := map[string]bool{}
+	entries := []archiveEntry{}
+
+	for i := range files {
+		name := claimName(archiveName(files[i].OriginalName), taken)
+
+		entries = append(entries, archiveEntry{name: name, modified: files[i].UpdatedAt, file: &files[i]})
+	}
+
+	return f.newArchive(userId, SelectionArchiveName, entries)
+}
+
+// newArchive checks the size of the entries against the archive limit of the user's plan
+func (f *fileService) newArchive(userId uuid.UUID, name string, entries []archiveEntry) (ArchiveInterface, error) {
+	limits, err := f.planLimits.GetPlanLimits(context.Background(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if entry.file != nil {
+			size += entry.file.Size
+		}
+	}
+
+	if size > limits.MaxArchiveSize {
+		return nil, ErrArchiveTooLarge
+	}
+
+	return &archive{fileService: f, name: name, entries: entries}, nil
+}
+
+func (a *archive) Name() string {
+	return a.name
+}
+
+func (a *archive) Write(w io.Writer) error {
+	writer := zip.NewWriter(w)
+
+	for _, entry := range a.entries {
+		if err := a.writeEntry(writer, entry); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+func (a *archive) writeEntry(writer *zip.Writer, entry archiveEntry) error {
+	header := &zip.FileHeader{Name: entry.name, Modified: entry.modified, Method: zip.Store}
+
+	if entry.file == nil {
+		_, err := writer.CreateHeader(header)
+		return err
+	}
+
+	if compressible(entry.file.MimeType) {
+		header.Method = zip.Deflate
+	}
+
+	stored, err := a.fileService.fileContent(*entry.file)
+	if errors.Is(err, ErrFileQuarantined) {
+		// quarantined files are left out rather than failing an archive that is already being sent
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	object, err := openContent(a.fileService.fileConfig, stored, entry.file.Size, nil)
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+
+	content, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(content, object.Body)
+
+	return err
+}
+
+// claimName marks name as taken, numbering it when it already is
+func claimName(name string, taken map[string]bool) string {
+	if taken[name] {
+		name = availableName(name, taken)
+	}
+
+	taken[name] = true
+
+	return name
+}
+
+// archiveName makes a file or folder name safe to use as one segment of a path inside an archive
+func archiveName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+
+	return name
+}
+
+// compressible reports whether deflating content of the type is worth it, most media and archives
+// are compressed already
+func compressible(mimeType string) bool {
+	mimeType = helper.BaseContentType(mimeType)
+
+	switch {
+	case mimeType == "image/svg+xml", mimeType == "image/bmp", mimeType == "image/x-icon":
+		return true
+	case strings.HasPrefix(mimeType, "image/"), strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "audio/"):
+		return false
+	case strings.Contains(mimeType, "zip"), strings.Contains(mimeType, "compressed"),
+		strings.Contains(mimeType, "x-7z"), strings.Contains(mimeType, "x-rar"), mimeType == "application/pdf":
+		return false
+	}
+
+	return true
+}
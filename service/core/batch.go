@@ -0,0 +1,133 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/helper"
+)
+
+var (
+	// MaxBatchFiles caps how many files a single batch upload can carry
+	MaxBatchFiles = 100
+	// BatchUploadWorkers bounds how many files of a batch are processed at the same time
+	BatchUploadWorkers = 4
+)
+
+var (
+	ErrTooManyBatchFiles = fmt.Errorf("at most %d files can be uploaded at once", MaxBatchFiles)
+	errBatchFileStopped  = errors.New("upload of the file stopped")
+)
+
+// BatchUploadResult is the outcome of one file of a batch upload, Err is set when it failed
+type BatchUploadResult struct {
+	FileName string
+	File     *dto.UploadedFileDTO
+	Err      error
+}
+
+// BatchUploadInterface uploads the files of one request through a bounded pool of workers
+type BatchUploadInterface interface {
+	// Add hands body to a worker and returns once it has been read, so the next file can be read
+	// while earlier ones are still being stored. It only fails when body itself can't be read.
+	Add(fileDto dto.FileDTO, body io.Reader) error
+	// Wait blocks until every added file is processed and returns the results in the order they were added
+	Wait() []BatchUploadResult
+}
+
+type batchUpload struct {
+	fileService *fileService
+	maxFileSize int64
+	slots       chan struct{}
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	results     []BatchUploadResult
+}
+
+// NewBatchUpload starts a batch upload for the user, each file is held to the upload limit of their plan
+func (f *fileService) NewBatchUpload(userId uuid.UUID) (BatchUploadInterface, error) {
+	limits, err := f.planLimits.GetPlanLimits(context.Background(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batchUpload{
+		fileService: f,
+		maxFileSize: limits.MaxUploadSize,
+		slots:       make(chan struct{}, BatchUploadWorkers),
+	}, nil
+}
+
+func (b *batchUpload) Add(fileDto dto.FileDTO, body io.Reader) error {
+	b.mu.Lock()
+	index := len(b.results)
+	b.results = append(b.results, BatchUploadResult{FileName: fileDto.OriginalName})
+	b.mu.Unlock()
+
+	if index >= MaxBatchFiles {
+		b.setResult(index, nil, ErrTooManyBatchFiles)
+		return nil
+	}
+
+	// wait for a free worker
+	b.slots <- struct{}{}
+
+	reader, writer := io.Pipe()
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() { <-b.slots }()
+
+		uploaded, err := b.fileService.UploadFile(fileDto, helper.NewLimitedReader(reader, b.maxFileSize))
+
+		// a file rejected before it was fully read must not leave Add blocked on the pipe
+		reader.CloseWithError(errBatchFileStopped)
+
+		if err != nil {
+			b.setResult(index, nil, err)
+			return
+		}
+
+		b.setResult(index, &uploaded, nil)
+	}()
+
+	counter := &helper.CountingReader{Reader: body}
+
+	_, err := io.Copy(writer, counter)
+	writer.CloseWithError(counter.Err)
+
+	// write errors only mean the worker stopped reading, it reports why itself
+	if counter.Err != nil {
+		return counter.Err
+	}
+
+	if err != nil && !errors.Is(err, errBatchFileStopped) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *batchUpload) Wait() []BatchUploadResult {
+	b.wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.results
+}
+
+func (b *batchUpload) setResult(index int, file *dto.UploadedFileDTO, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[index].File = file
+	b.results[index].Err = err
+}
@@ -0,0 +1,244 @@
+package core_service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+var (
+	ContentTypeMismatchCorrect = "correct"
+	ContentTypeMismatchReject  = "reject"
+)
+
+// ContentTypeMismatchPolicy decides what happens when the content doesn't match the declared type,
+// "correct" stores the detected type instead and "reject" refuses the upload
+var ContentTypeMismatchPolicy = ContentTypeMismatchCorrect
+
+var (
+	ErrContentTypeMismatch       = errors.New("the file content does not match its declared content type")
+	ErrContentTypeBlocked        = errors.New("files of this type can't be uploaded")
+	ErrContentTypeNotAllowed     = errors.New("files of this type are not in your allowed content types")
+	ErrInvalidContentTypePattern = errors.New("content type must look like type/subtype, type/* or */*")
+	ErrContentTypeRuleExists     = errors.New("a rule for this content type already exists")
+	ErrContentTypeRuleNotFound   = errors.New("content type rule not found")
+)
+
+var contentTypePattern = regexp.MustCompile(`^([a-z0-9][a-z0-9!#$&^_.+-]*|\*)/([a-z0-9][a-z0-9!#$&^_.+-]*|\*)$`)
+
+type ContentTypeServiceInterface interface {
+	ResolveContentType(userId uuid.UUID, declared string, head []byte) (string, error)
+	CheckScriptedContent(contentType string) error
+	FindBlockedTypes() ([]dto.ContentTypeRuleDTO, error)
+	BlockType(pattern string, scriptOnly bool) (dto.ContentTypeRuleDTO, error)
+	UnblockType(id uuid.UUID) error
+	FindAllowedTypes(userId uuid.UUID) ([]dto.ContentTypeRuleDTO, error)
+	AllowType(userId uuid.UUID, pattern string) (dto.ContentTypeRuleDTO, error)
+	RemoveAllowedType(id uuid.UUID, userId uuid.UUID) error
+}
+
+type contentTypeService struct {
+	ruleRepository core_repository.ContentTypeRuleRepositoryInterface
+}
+
+func NewContentTypeService(ruleRepository core_repository.ContentTypeRuleRepositoryInterface) ContentTypeServiceInterface {
+	return &contentTypeService{ruleRepository: ruleRepository}
+}
+
+func (s *contentTypeService) ConvertToDTO(rule model.ContentTypeRule) dto.ContentTypeRuleDTO {
+	var ruleDto dto.ContentTypeRuleDTO
+
+	ruleDto.ID = rule.ID
+	ruleDto.UserID = rule.UserID
+	ruleDto.Pattern = rule.Pattern
+	ruleDto.ScriptOnly = rule.ScriptOnly
+	ruleDto.CreatedAt = rule.CreatedAt
+	ruleDto.UpdatedAt = rule.UpdatedAt
+
+	return ruleDto
+}
+
+// ResolveContentType detects the type of an upload from its first bytes, applies the mismatch policy
+// to the declared type and checks the result against the blocked and the user's allowed types.
+// It returns the type the file is stored with.
+func (s *contentTypeService) ResolveContentType(userId uuid.UUID, declared string, head []byte) (string, error) {
+	detected, scripted := helper.SniffContentType(head)
+	declared = helper.BaseContentType(declared)
+
+	contentType := declared
+	switch {
+	case declared == "" || declared == helper.ContentTypeUnknown:
+		contentType = detected
+	case !helper.ContentTypeCompatible(declared, detected):
+		if ContentTypeMismatchPolicy == ContentTypeMismatchReject {
+			return "", ErrContentTypeMismatch
+		}
+
+		contentType = detected
+	}
+
+	blocked, err := s.ruleRepository.FindGlobalRules()
+	if err != nil {
+		return "", err
+	}
+
+	for _, rule := range blocked {
+		if rule.ScriptOnly && !scripted {
+			continue
+		}
+
+		// the detected type is checked too, so a declared type can't hide what the content is
+		if helper.MatchContentType(rule.Pattern, contentType) || helper.MatchContentType(rule.Pattern, detected) {
+			return "", ErrContentTypeBlocked
+		}
+	}
+
+	allowed, err := s.ruleRepository.FindUserRules(userId)
+	if err != nil {
+		return "", err
+	}
+
+	if len(allowed) == 0 {
+		return contentType, nil
+	}
+
+	for _, rule := range allowed {
+		if helper.MatchContentType(rule.Pattern, contentType) {
+			return contentType, nil
+		}
+	}
+
+	return "", ErrContentTypeNotAllowed
+}
+
+// CheckScriptedContent applies the script only blocking rules to markup found to carry script past
+// the head ResolveContentType looked at
+func (s *contentTypeService) CheckScriptedContent(contentType string) error {
+	blocked, err := s.ruleRepository.FindGlobalRules()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range blocked {
+		if rule.ScriptOnly && helper.MatchContentType(rule.Pattern, contentType) {
+			return ErrContentTypeBlocked
+		}
+	}
+
+	return nil
+}
+
+func (s *contentTypeService) FindBlockedTypes() ([]dto.ContentTypeRuleDTO, error) {
+	rules, err := s.ruleRepository.FindGlobalRules()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertRules(rules), nil
+}
+
+// BlockType adds a global blocking rule, scriptOnly limits it to markup that carries script
+func (s *contentTypeService) BlockType(pattern string, scriptOnly bool) (dto.ContentTypeRuleDTO, error) {
+	rules, err := s.ruleRepository.FindGlobalRules()
+	if err != nil {
+		return dto.ContentTypeRuleDTO{}, err
+	}
+
+	return s.addRule(rules, model.ContentTypeRule{Pattern: pattern, ScriptOnly: scriptOnly})
+}
+
+func (s *contentTypeService) UnblockType(id uuid.UUID) error {
+	rule, err := s.findRule(id)
+	if err != nil {
+		return err
+	}
+
+	if rule.UserID != nil {
+		return ErrContentTypeRuleNotFound
+	}
+
+	return s.ruleRepository.DeleteRule(rule.ID)
+}
+
+func (s *contentTypeService) FindAllowedTypes(userId uuid.UUID) ([]dto.ContentTypeRuleDTO, error) {
+	rules, err := s.ruleRepository.FindUserRules(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertRules(rules), nil
+}
+
+// AllowType adds a type to the user's allow list, once the list has entries only matching uploads are accepted
+func (s *contentTypeService) AllowType(userId uuid.UUID, pattern string) (dto.ContentTypeRuleDTO, error) {
+	rules, err := s.ruleRepository.FindUserRules(userId)
+	if err != nil {
+		return dto.ContentTypeRuleDTO{}, err
+	}
+
+	return s.addRule(rules, model.ContentTypeRule{UserID: &userId, Pattern: pattern})
+}
+
+func (s *contentTypeService) RemoveAllowedType(id uuid.UUID, userId uuid.UUID) error {
+	rule, err := s.findRule(id)
+	if err != nil {
+		return err
+	}
+
+	if rule.UserID == nil || *rule.UserID != userId {
+		return ErrContentTypeRuleNotFound
+	}
+
+	return s.ruleRepository.DeleteRule(rule.ID)
+}
+
+// addRule validates and stores rule unless existing already holds the same pattern
+func (s *contentTypeService) addRule(existing []model.ContentTypeRule, rule model.ContentTypeRule) (dto.ContentTypeRuleDTO, error) {
+	rule.Pattern = helper.BaseContentType(rule.Pattern)
+	if !contentTypePattern.MatchString(rule.Pattern) || (strings.HasPrefix(rule.Pattern, "*/") && rule.Pattern != "*/*") {
+		return dto.ContentTypeRuleDTO{}, ErrInvalidContentTypePattern
+	}
+
+	for _, other := range existing {
+		if other.Pattern == rule.Pattern {
+			return dto.ContentTypeRuleDTO{}, ErrContentTypeRuleExists
+		}
+	}
+
+	rule, err := s.ruleRepository.CreateRule(rule)
+	if err != nil {
+		return dto.ContentTypeRuleDTO{}, err
+	}
+
+	return s.ConvertToDTO(rule), nil
+}
+
+func (s *contentTypeService) findRule(id uuid.UUID) (model.ContentTypeRule, error) {
+	rule, err := s.ruleRepository.FindRuleById(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return model.ContentTypeRule{}, ErrContentTypeRuleNotFound
+		}
+
+		return model.ContentTypeRule{}, err
+	}
+
+	return rule, nil
+}
+
+func (s *contentTypeService) convertRules(rules []model.ContentTypeRule) []dto.ContentTypeRuleDTO {
+	rulesDto := []dto.ContentTypeRuleDTO{}
+	for _, rule := range rules {
+		rulesDto = append(rulesDto, s.ConvertToDTO(rule))
+	}
+
+	return rulesDto
+}
@@ -0,0 +1,279 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+var (
+	ErrDirectUploadNotFound   = errors.New("direct upload not found")
+	ErrDirectUploadIncomplete = errors.New("object has not been uploaded yet")
+)
+
+var (
+	// DirectUploadURLLifetime is how long a presigned upload URL stays valid
+	DirectUploadURLLifetime = 15 * time.Minute
+	// DirectUploadFinalizeWindow is how long after the URL expires the upload can still be finalized
+	// before the garbage collector removes the object
+	DirectUploadFinalizeWindow = time.Hour
+)
+
+type DirectUploadServiceInterface interface {
+	CreateDirectUpload(uploadDto dto.DirectUploadDTO) (dto.DirectUploadDTO, error)
+	FinalizeDirectUpload(id uuid.UUID, userId uuid.UUID) (dto.UploadedFileDTO, error)
+	CleanupExpiredDirectUploads(ctx context.Context) error
+}
+
+type directUploadService struct {
+	fileConfig             config.FileConfigInterface
+	directUploadRepository core_repository.DirectUploadRepositoryInterface
+	folderRepository       core_repository.FolderRepositoryInterface
+	fileService            FileServiceInterface
+	contentTypes           ContentTypeServiceInterface
+	usage                  StorageUsageServiceInterface
+	planLimits             PlanLimitChecker
+	permissions            PermissionServiceInterface
+}
+
+func NewDirectUploadService(
+	fileConfig config.FileConfigInterface,
+	directUploadRepository core_repository.DirectUploadRepositoryInterface,
+	folderRepository core_repository.FolderRepositoryInterface,
+	fileService FileServiceInterface,
+	contentTypes ContentTypeServiceInterface,
+	usage StorageUsageServiceInterface,
+	planLimits PlanLimitChecker,
+	permissions PermissionServiceInterface,
+) DirectUploadServiceInterface {
+	return &directUploadService{
+		fileConfig:             fileConfig,
+		directUploadRepository: directUploadRepository,
+		folderRepository:       folderRepository,
+		fileService:            fileService,
+		contentTypes:           contentTypes,
+		usage:                  usage,
+		planLimits:             planLimits,
+		permissions:            permissions,
+	}
+}
+
+func (d *directUploadService) ConvertToDTO(upload model.DirectUpload) dto.DirectUploadDTO {
+	var uploadDto dto.DirectUploadDTO
+
+	uploadDto.ID = upload.ID
+	uploadDto.UserID = upload.UserID
+	uploadDto.FolderID = upload.FolderID
+	uploadDto.Key = upload.Key
+	uploadDto.OriginalName = upload.OriginalName
+	uploadDto.MimeType = upload.MimeType
+	uploadDto.Visibility = upload.Visibility
+	uploadDto.ExpiresAt = upload.ExpiresAt
+	uploadDto.CreatedAt = upload.CreatedAt
+	uploadDto.UpdatedAt = upload.UpdatedAt
+
+	return uploadDto
+}
+
+// CreateDirectUpload reserves a key for the file and returns a presigned URL the client uploads the bytes to
+func (d *directUploadService) CreateDirectUpload(uploadDto dto.DirectUploadDTO) (dto.DirectUploadDTO, error) {
+	limits, err := d.planLimits.GetPlanLimits(context.Background(), uploadDto.UserID)
+	if err != nil {
+		return dto.DirectUploadDTO{}, err
+	}
+
+	visibility, err := ParseVisibility(uploadDto.Visibility)
+	if err != nil {
+		return dto.DirectUploadDTO{}, err
+	}
+
+	if uploadDto.Size > limits.MaxUploadSize {
+		return dto.DirectUploadDTO{}, helper.ErrBodyTooLarge
+	}
+
+	// files uploaded to a folder shared with the uploader belong to the folder's owner
+	ownerId := uploadDto.UserID
+	if uploadDto.FolderID != nil {
+		folder, err := findFolder(d.folderRepository, d.permissions, *uploadDto.FolderID, uploadDto.UserID, PermissionRoleEditor)
+		if err != nil {
+			return dto.DirectUploadDTO{}, err
+		}
+
+		ownerId = folder.UserID
+	}
+
+	if err := d.usage.CheckQuota(ownerId, uploadDto.Size); err != nil {
+		return dto.DirectUploadDTO{}, err
+	}
+
+	key := d.fileConfig.FileKey(uploadDto.OriginalName, uploadDto.MimeType)
+	path := d.fileConfig.GetObjectPath(ownerId.String(), key)
+
+	url, err := d.fileConfig.PresignPutObject(path, uploadDto.MimeType, DirectUploadURLLifetime)
+	if err != nil {
+		return dto.DirectUploadDTO{}, err
+	}
+
+	upload, err := d.directUploadRepository.CreateDirectUpload(model.DirectUpload{
+		UserID:       uploadDto.UserID,
+		OwnerID:      ownerId,
+		FolderID:     uploadDto.FolderID,
+		Key:          key,
+		OriginalName: uploadDto.OriginalName,
+		MimeType:     uploadDto.MimeType,
+		Visibility:   visibility,
+		ExpiresAt:    time.Now().Add(DirectUploadURLLifetime + DirectUploadFinalizeWindow),
+	})
+	if err != nil {
+		return dto.DirectUploadDTO{}, err
+	}
+
+	createdDto := d.ConvertToDTO(upload)
+	createdDto.Size = uploadDto.Size
+	createdDto.URL = url
+	createdDto.Method = "PUT"
+	createdDto.Headers = map[string]string{"Content-Type": upload.MimeType}
+
+	return createdDto, nil
+}
+
+// FinalizeDirectUpload checks the object landed in storage and records it as a file
+func (d *directUploadService) FinalizeDirectUpload(id uuid.UUID, userId uuid.UUID) (dto.UploadedFileDTO, error) {
+	upload, err := d.directUploadRepository.FindDirectUploadById(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return dto.UploadedFileDTO{}, ErrDirectUploadNotFound
+		}
+
+		return dto.UploadedFileDTO{}, err
+	}
+
+	if upload.UserID != userId {
+		return dto.UploadedFileDTO{}, ErrDirectUploadNotFound
+	}
+
+	path := d.fileConfig.GetObjectPath(upload.OwnerID.String(), upload.Key)
+
+	info, err := d.fileConfig.HeadObject(path)
+	if err != nil {
+		if errors.Is(err, config.ErrObjectNotFound) {
+			return dto.UploadedFileDTO{}, ErrDirectUploadIncomplete
+		}
+
+		return dto.UploadedFileDTO{}, err
+	}
+
+	limits, err := d.planLimits.GetPlanLimits(context.Background(), upload.UserID)
+	if err != nil {
+		return dto.UploadedFileDTO{}, err
+	}
+
+	// the presigned URL can't cap the body size, so an oversized object is only caught here
+	rejectErr := d.usage.CheckQuota(upload.OwnerID, info.Size)
+	if info.Size > limits.MaxUploadSize {
+		rejectErr = helper.ErrBodyTooLarge
+	}
+
+	// access to the folder may have been taken away since the upload was created
+	if rejectErr == nil && upload.FolderID != nil {
+		_, rejectErr = findFolder(d.folderRepository, d.permissions, *upload.FolderID, upload.UserID, PermissionRoleEditor)
+	}
+
+	if rejectErr != nil {
+		if claimed, err := d.directUploadRepository.DeleteDirectUpload(upload.ID); err == nil && claimed {
+			d.fileConfig.DeleteObject(path)
+		}
+
+		return dto.UploadedFileDTO{}, rejectErr
+	}
+
+	claimed, err := d.directUploadRepository.DeleteDirectUpload(upload.ID)
+	if err != nil {
+		return dto.UploadedFileDTO{}, err
+	}
+
+	if !claimed {
+		return dto.UploadedFileDTO{}, ErrDirectUploadNotFound
+	}
+
+	mimeType := info.ContentType
+	if mimeType == "" {
+		mimeType = upload.MimeType
+	}
+
+	// only the head is read here, hashing and encrypting the whole object is left to ProcessPendingFiles
+	head, err := d.readHead(path, info.Size)
+	if err != nil {
+		d.fileConfig.DeleteObject(path)
+		return dto.UploadedFileDTO{}, err
+	}
+
+	mimeType, err = d.contentTypes.ResolveContentType(upload.OwnerID, mimeType, head)
+	if err != nil {
+		d.fileConfig.DeleteObject(path)
+		return dto.UploadedFileDTO{}, err
+	}
+
+	fileDto := dto.FileDTO{
+		UserID:       upload.OwnerID,
+		FolderID:     upload.FolderID,
+		OriginalName: upload.OriginalName,
+		MimeType:     mimeType,
+		Visibility:   upload.Visibility,
+	}
+	if upload.OwnerID != upload.UserID {
+		fileDto.UploadedBy = &upload.UserID
+	}
+
+	return d.fileService.CreateFileFromObject(fileDto, dto.StoredObjectDTO{Key: upload.Key, Size: info.Size})
+}
+
+// readHead returns the leading bytes of a stored object content type detection looks at
+func (d *directUploadService) readHead(path string, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+
+	obj, err := d.fileConfig.GetObject(path, &dto.ByteRange{Start: 0, End: min(size, helper.SniffLength) - 1})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	return io.ReadAll(obj.Body)
+}
+
+// CleanupExpiredDirectUploads removes objects that were uploaded but never finalized
+func (d *directUploadService) CleanupExpiredDirectUploads(ctx context.Context) error {
+	uploads, err := d.directUploadRepository.FindExpiredDirectUploads(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads {
+		claimed, err := d.directUploadRepository.DeleteDirectUpload(upload.ID)
+		if err != nil {
+			return err
+		}
+
+		if !claimed {
+			continue
+		}
+
+		if err := d.fileConfig.DeleteObject(d.fileConfig.GetObjectPath(upload.OwnerID.String(), upload.Key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+package core_service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+// keyRotationBatchSize bounds how many user keys a single rotation run loads at once
+const keyRotationBatchSize = 100
+
+var (
+	ErrInvalidMasterKeys = errors.New("master keys must be a comma separated list of id:key pairs with unique ids and base64 encoded 32 byte keys")
+	ErrMasterKeyMissing  = errors.New("the master key protecting this content is not configured")
+)
+
+// ParseMasterKeys reads master keys from a comma separated list of id:key pairs, keys are base64 encoded.
+// The first key is the current one, the others are only kept to unwrap user keys until they are rotated.
+// An empty list turns encryption off.
+func ParseMasterKeys(spec string) (string, map[string][]byte, error) {
+	keys := map[string][]byte{}
+	current := ""
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, found := strings.Cut(pair, ":")
+		id = strings.TrimSpace(id)
+		if !found || id == "" || len(id) > 64 || keys[id] != nil {
+			return "", nil, ErrInvalidMasterKeys
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != helper.EncryptionKeySize {
+			return "", nil, ErrInvalidMasterKeys
+		}
+
+		if current == "" {
+			current = id
+		}
+
+		keys[id] = key
+	}
+
+	return current, keys, nil
+}
+
+// EncryptionServiceInterface hands out the keys objects are encrypted with. Each object has its own data
+// key, wrapped by a key of its owner, which is in turn wrapped by a master key from the configuration.
+type EncryptionServiceInterface interface {
+	// Enabled reports whether new objects are encrypted
+	Enabled() bool
+	// NewDataKey returns a fresh data key for an object of the user along with its wrapped form to
+	// store, both are nil when encryption is off
+	NewDataKey(userId uuid.UUID) ([]byte, []byte, error)
+	// DataKey unwraps the data key of an object of the user, nil for plaintext objects
+	DataKey(userId uuid.UUID, wrappedKey []byte) ([]byte, error)
+	// RotateMasterKey rewraps every user key still wrapped by an older master key with the current one
+	RotateMasterKey(ctx context.Context) error
+}
+
+type encryptionService struct {
+	keyRepository core_repository.UserKeyRepositoryInterface
+	masterKeys    map[string][]byte
+	currentKeyId  string
+}
+
+func NewEncryptionService(keyRepository core_repository.UserKeyRepositoryInterface, currentKeyId string, masterKeys map[string][]byte) EncryptionServiceInterface {
+	return &encryptionService{keyRepository: keyRepository, masterKeys: masterKeys, currentKeyId: currentKeyId}
+}
+
+func (e *encryptionService) Enabled() bool {
+	return e.currentKeyId != ""
+}
+
+func (e *encryptionService) NewDataKey(userId uuid.UUID) ([]byte, []byte, error) {
+	if !e.Enabled() {
+		return nil, nil, nil
+	}
+
+	userKey, err := e.userKey(userId, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, err := helper.NewEncryptionKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrappedKey, err := helper.WrapKey(userKey, dataKey, userId[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, wrappedKey, nil
+}
+
+func (e *encryptionService) DataKey(userId uuid.UUID, wrappedKey []byte) ([]byte, error) {
+	if wrappedKey == nil {
+		return nil, nil
+	}
+
+	userKey, err := e.userKey(userId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return helper.UnwrapKey(userKey, wrappedKey, userId[:])
+}
+
+// userKey returns the user's unwrapped key, creating it first when create is set and they have none
+func (e *encryptionService) userKey(userId uuid.UUID, create bool) ([]byte, error) {
+	key, err := e.keyRepository.FindUserKey(userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) && create {
+		key, err = e.createUserKey(userId)
+	}
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMasterKeyMissing
+		}
+
+		return nil, err
+	}
+
+	masterKey, ok := e.masterKeys[key.MasterKeyID]
+	if !ok {
+		return nil, ErrMasterKeyMissing
+	}
+
+	return helper.UnwrapKey(masterKey, key.WrappedKey, userId[:])
+}
+
+func (e *encryptionService) createUserKey(userId uuid.UUID) (model.UserKey, error) {
+	userKey, err := helper.NewEncryptionKey()
+	if err != nil {
+		return model.UserKey{}, err
+	}
+
+	wrappedKey, err := helper.WrapKey(e.masterKeys[e.currentKeyId], userKey, userId[:])
+	if err != nil {
+		return model.UserKey{}, err
+	}
+
+	return e.keyRepository.CreateUserKey(model.UserKey{UserID: userId, MasterKeyID: e.currentKeyId, WrappedKey: wrappedKey})
+}
+
+func (e *encryptionService) RotateMasterKey(ctx context.Context) error {
+	if !e.Enabled() {
+		return nil
+	}
+
+	for {
+		keys, err := e.keyRepository.FindUserKeysNotWrappedBy(e.currentKeyId, keyRotationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			masterKey, ok := e.masterKeys[key.MasterKeyID]
+			if !ok {
+				return fmt.Errorf("user key %s: master key %q: %w", key.ID, key.MasterKeyID, ErrMasterKeyMissing)
+			}
+
+			userKey, err := helper.UnwrapKey(masterKey, key.WrappedKey, key.UserID[:])
+			if err != nil {
+				return fmt.Errorf("user key %s: %w", key.ID, err)
+			}
+
+			wrappedKey, err := helper.WrapKey(e.masterKeys[e.currentKeyId], userKey, key.UserID[:])
+			if err != nil {
+				return err
+			}
+
+			if _, err := e.keyRepository.RewrapUserKey(key.ID, key.MasterKeyID, e.currentKeyId, wrappedKey); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < keyRotationBatchSize {
+			return nil
+		}
+	}
+}
+
+// storedContent is an object holding file content and the data key it is encrypted with, nil when it isn't
+type storedContent struct {
+	path string
+	key  []byte
+}
+
+// storeObject streams body to storage, encrypted with a fresh data key of the user when encryption is on.
+// Markup is scanned for script as a whole and removed again when a script only rule blocks it.
+func (f *fileService) storeObject(userId uuid.UUID, fileName string, mimeType string, body io.Reader) (dto.StoredObjectDTO, error) {
+	dataKey, wrappedKey, err := f.encryption.NewDataKey(userId)
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+
+	var detector *helper.ScriptDetector
+	if helper.IsMarkup(mimeType) {
+		detector = helper.NewScriptDetector(body)
+		body = detector
+	}
+
+	stored, err := f.fileConfig.UploadFile(userId.String(), fileName, mimeType, body, dataKey)
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+
+	if detector != nil && detector.Scripted() {
+		if err := f.contentTypes.CheckScriptedContent(mimeType); err != nil {
+			f.fileConfig.DeleteObject(f.fileConfig.GetObjectPath(userId.String(), stored.Key))
+			return dto.StoredObjectDTO{}, err
+		}
+	}
+
+	stored.WrappedKey = wrappedKey
+
+	return stored, nil
+}
+
+// openContent reads content, or only byteRange of it, decrypting it when it is encrypted. size is the
+// size of the plaintext.
+func openContent(fileConfig config.FileConfigInterface, content storedContent, size int64, byteRange *dto.ByteRange) (dto.GetFileDTO, error) {
+	if content.key == nil {
+		return fileConfig.GetObject(content.path, byteRange)
+	}
+
+	start, end := int64(0), size-1
+	if byteRange != nil {
+		start, end = byteRange.Start, byteRange.End
+	}
+
+	from, to := helper.EncryptedRange(size, start, end)
+
+	// the header carries the nonce prefix, it is only part of the range when that starts at the beginning
+	var header []byte
+	if from > 0 {
+		object, err := fileConfig.GetObject(content.path, &dto.ByteRange{Start: 0, End: helper.EncryptionHeaderSize - 1})
+		if err != nil {
+			return dto.GetFileDTO{}, err
+		}
+
+		header, err = io.ReadAll(object.Body)
+		object.Body.Close()
+		if err != nil {
+			return dto.GetFileDTO{}, err
+		}
+	}
+
+	object, err := fileConfig.GetObject(content.path, &dto.ByteRange{Start: from, End: to})
+	if err != nil {
+		return dto.GetFileDTO{}, err
+	}
+
+	body, err := helper.NewDecryptingReader(object.Body, content.key, header, size, start, end)
+	if err != nil {
+		object.Body.Close()
+		return dto.GetFileDTO{}, err
+	}
+
+	length := max(end-start+1, 0)
+
+	object.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, object.Body}
+	object.ContentLength = &length
+	object.Range = byteRange
+
+	return object, nil
+}
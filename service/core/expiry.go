@@ -0,0 +1,215 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+	user_repository "github.com/shordem/api.thryvo/repository/user"
+	"github.com/shordem/api.thryvo/service"
+)
+
+// ExpiryWarningLead is how long before a file expires its owner is warned, when they asked to be
+var ExpiryWarningLead = 24 * time.Hour
+
+// expiryBatchSize bounds how many files a single sweep or warning run loads at once
+const expiryBatchSize = 100
+
+var (
+	ErrFileExpired   = errors.New("this file has expired")
+	ErrInvalidExpiry = errors.New("expires_at must be an RFC 3339 time in the future and ttl a number of seconds or a duration such as 72h, only one of them can be set")
+)
+
+// ParseExpiry reads an expiry given either as an RFC 3339 time or as a time to live from now, in
+// seconds or as a duration such as 72h. It returns nil when neither is set.
+func ParseExpiry(expiresAt string, ttl string, now time.Time) (*time.Time, error) {
+	expiresAt, ttl = strings.TrimSpace(expiresAt), strings.TrimSpace(ttl)
+
+	switch {
+	case expiresAt != "" && ttl != "":
+		return nil, ErrInvalidExpiry
+	case expiresAt != "":
+		expiry, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil || !expiry.After(now) {
+			return nil, ErrInvalidExpiry
+		}
+
+		expiry = expiry.UTC()
+
+		return &expiry, nil
+	case ttl != "":
+		duration, err := time.ParseDuration(ttl)
+		if seconds, convErr := strconv.ParseInt(ttl, 10, 64); convErr == nil {
+			duration, err = time.Duration(seconds)*time.Second, nil
+		}
+
+		if err != nil || duration <= 0 {
+			return nil, ErrInvalidExpiry
+		}
+
+		expiry := now.Add(duration).UTC()
+
+		return &expiry, nil
+	}
+
+	return nil, nil
+}
+
+// SetExpiry changes when a file expires, a nil expiresAt keeps it until it is deleted by hand
+func (f *fileService) SetExpiry(id uuid.UUID, userId uuid.UUID, expiresAt *time.Time, warning bool) (dto.FileDTO, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return dto.FileDTO{}, ErrInvalidExpiry
+	}
+
+	file, err := f.findFile(id, userId, PermissionRoleOwner)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	// an expired file is treated as gone, it can't be brought back by moving its expiry
+	if file.ExpiresAt != nil && !file.ExpiresAt.After(time.Now()) {
+		return dto.FileDTO{}, ErrFileExpired
+	}
+
+	warning = warning && expiresAt != nil
+
+	if err := f.fileRepository.UpdateFileExpiry(file.ID, expiresAt, warning); err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	file.ExpiresAt = expiresAt
+	file.ExpiryWarning = warning
+
+	fileDto := f.ConvertToDTO(file)
+	fileDto.Path = f.fileConfig.GetObjectPath(file.UserID.String(), file.Key)
+
+	return fileDto, nil
+}
+
+// PurgeExpiredFiles permanently deletes every file whose expiry has passed, trashed ones included
+func (f *fileService) PurgeExpiredFiles(ctx context.Context) error {
+	for {
+		now := time.Now()
+
+		files, err := f.fileRepository.FindFilesExpiredBefore(now, expiryBatchSize)
+		if err != nil {
+			return err
+		}
+
+		// the row is only deleted while it is still expired, its expiry may have moved since it was loaded
+		deleteRow := func(id uuid.UUID) (bool, error) {
+			return f.fileRepository.PurgeExpiredFile(id, now)
+		}
+
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := f.purge(file, deleteRow); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < expiryBatchSize {
+			return nil
+		}
+	}
+}
+
+type FileExpiryNotifierInterface interface {
+	WarnExpiringFiles(ctx context.Context) error
+}
+
+type fileExpiryNotifier struct {
+	fileRepository core_repository.FileRepositoryInterface
+	userRepository user_repository.UserRepositoryInterface
+	mail           service.EmailServiceInterface
+}
+
+// NewFileExpiryNotifier emails owners about their files that expire within ExpiryWarningLead
+func NewFileExpiryNotifier(
+	fileRepository core_repository.FileRepositoryInterface,
+	userRepository user_repository.UserRepositoryInterface,
+	mail service.EmailServiceInterface,
+) FileExpiryNotifierInterface {
+	return &fileExpiryNotifier{fileRepository: fileRepository, userRepository: userRepository, mail: mail}
+}
+
+// WarnExpiringFiles sends every owner one email listing their files that are about to expire,
+// each file is only ever warned about once per expiry
+func (n *fileExpiryNotifier) WarnExpiringFiles(ctx context.Context) error {
+	for {
+		files, err := n.fileRepository.FindFilesExpiringBefore(time.Now().Add(ExpiryWarningLead), expiryBatchSize)
+		if err != nil {
+			return err
+		}
+
+		byUser := map[uuid.UUID][]model.File{}
+		for _, file := range files {
+			byUser[file.UserID] = append(byUser[file.UserID], file)
+		}
+
+		for userId, userFiles := range byUser {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := n.warn(userId, userFiles); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < expiryBatchSize {
+			return nil
+		}
+	}
+}
+
+func (n *fileExpiryNotifier) warn(userId uuid.UUID, files []model.File) error {
+	ids := []uuid.UUID{}
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+
+	user, err := n.userRepository.FindUserById(userId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// files of a missing user are still marked, so they don't come up in every run
+	if err == nil {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].ExpiresAt.Before(*files[j].ExpiresAt)
+		})
+
+		expiring := []map[string]string{}
+		for _, file := range files {
+			expiring = append(expiring, map[string]string{
+				"Name":      file.OriginalName,
+				"ExpiresAt": file.ExpiresAt.UTC().Format("Jan 2, 2006 15:04 MST"),
+			})
+		}
+
+		_ = n.mail.SendEmail(service.SendEmailParams{
+			To:       user.Email,
+			Subject:  "Your FileCapsa files are about to expire",
+			Template: "file-expiry",
+			Variables: map[string]interface{}{
+				"FullName": user.FirstName + " " + user.LastName,
+				"Files":    expiring,
+			},
+		})
+	}
+
+	return n.fileRepository.MarkExpiryWarned(ids)
+}
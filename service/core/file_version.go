@@ -0,0 +1,207 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+)
+
+var ErrVersionNotFound = errors.New("file version not found")
+
+func (f *fileService) ConvertVersionToDTO(version model.FileVersion, current int) dto.FileVersionDTO {
+	var versionDto dto.FileVersionDTO
+
+	versionDto.ID = version.ID
+	versionDto.FileID = version.FileID
+	versionDto.Number = version.Number
+	versionDto.Size = version.Size
+	if version.Hash != nil {
+		versionDto.Hash = *version.Hash
+	}
+	if version.MD5 != nil {
+		versionDto.MD5 = *version.MD5
+	}
+	versionDto.MimeType = version.MimeType
+	versionDto.UploadedBy = version.UploadedBy
+	versionDto.Current = version.Number == current
+	versionDto.CreatedAt = version.CreatedAt
+	versionDto.UpdatedAt = version.UpdatedAt
+
+	return versionDto
+}
+
+// UploadVersion stores body as the new current content of a file, keeping the earlier versions
+// up to the limit of the owner's plan
+func (f *fileService) UploadVersion(id uuid.UUID, userId uuid.UUID, mimeType string, body io.Reader) (dto.FileDTO, error) {
+	file, err := f.findFile(id, userId, PermissionRoleEditor)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	// processing fills in the first version, it has to be done before there are others
+	if file.ProcessingStatus == ProcessingStatusPending {
+		return dto.FileDTO{}, ErrFileProcessing
+	}
+
+	if mimeType == "" {
+		mimeType = file.MimeType
+	}
+
+	head, body, err := helper.PeekHead(body)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	mimeType, err = f.contentTypes.ResolveContentType(file.UserID, mimeType, head)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	body, err = f.quotaLimited(file.UserID, body)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	stored, err := f.storeObject(file.UserID, file.OriginalName, mimeType, body)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	blob, err := f.storeBlob(file.UserID, stored)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	return f.addVersion(file, model.FileVersion{
+		FileID:     file.ID,
+		BlobID:     &blob.ID,
+		Size:       stored.Size,
+		Hash:       &stored.Hash,
+		MD5:        &stored.MD5,
+		MimeType:   mimeType,
+		UploadedBy: &userId,
+	})
+}
+
+// RestoreVersion makes an earlier version current again by adding it as the newest version,
+// so the history in between is kept
+func (f *fileService) RestoreVersion(id uuid.UUID, userId uuid.UUID, number int) (dto.FileDTO, error) {
+	file, err := f.findFile(id, userId, PermissionRoleEditor)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	// processing fills in the first version, it has to be done before there are others
+	if file.ProcessingStatus == ProcessingStatusPending {
+		return dto.FileDTO{}, ErrFileProcessing
+	}
+
+	version, err := f.versionRepository.FindVersion(file.ID, number)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return dto.FileDTO{}, ErrVersionNotFound
+		}
+
+		return dto.FileDTO{}, err
+	}
+
+	if version.BlobID == nil {
+		return dto.FileDTO{}, ErrVersionNotFound
+	}
+
+	if err := f.blobRepository.AddReference(*version.BlobID); err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	return f.addVersion(file, model.FileVersion{
+		FileID:     file.ID,
+		BlobID:     version.BlobID,
+		Size:       version.Size,
+		Hash:       version.Hash,
+		MD5:        version.MD5,
+		MimeType:   version.MimeType,
+		UploadedBy: &userId,
+	})
+}
+
+// addVersion records a version whose blob reference is already held, releasing it when that fails
+func (f *fileService) addVersion(file model.File, version model.FileVersion) (dto.FileDTO, error) {
+	version, err := f.versionRepository.AddVersion(version)
+	if err != nil {
+		f.releaseBlob(*version.BlobID)
+		return dto.FileDTO{}, err
+	}
+
+	if err := f.pruneVersions(file); err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	updated, err := f.fileRepository.FindFileById(file.ID)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	fileDto := f.ConvertToDTO(updated)
+	fileDto.UserID = updated.UserID
+	fileDto.FolderID = updated.FolderID
+	fileDto.Path = f.fileConfig.GetObjectPath(updated.UserID.String(), updated.Key)
+
+	return fileDto, nil
+}
+
+// pruneVersions drops the oldest versions of a file beyond the number the owner's plan keeps
+func (f *fileService) pruneVersions(file model.File) error {
+	limits, err := f.planLimits.GetPlanLimits(context.Background(), file.UserID)
+	if err != nil {
+		return err
+	}
+
+	versions, err := f.versionRepository.FindVersionsByFileId(file.ID)
+	if err != nil {
+		return err
+	}
+
+	keep := limits.MaxFileVersions
+	if keep < 1 {
+		keep = 1
+	}
+
+	for i := keep; i < len(versions); i++ {
+		if err := f.versionRepository.DeleteVersion(versions[i].ID); err != nil {
+			return err
+		}
+
+		if err := f.removeVersionContent(versions[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindVersions lists the versions of a file the user can view, newest first
+func (f *fileService) FindVersions(id uuid.UUID, userId uuid.UUID) ([]dto.FileVersionDTO, error) {
+	file, err := f.findFile(id, userId, PermissionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := f.versionRepository.FindVersionsByFileId(file.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	versionsDto := []dto.FileVersionDTO{}
+	for _, version := range versions {
+		versionsDto = append(versionsDto, f.ConvertVersionToDTO(version, file.Version))
+	}
+
+	return versionsDto, nil
+}
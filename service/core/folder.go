@@ -1,6 +1,8 @@
 package core_service
 
 import (
+	"errors"
+
 	"github.com/google/uuid"
 
 	"github.com/shordem/api.thryvo/dto"
@@ -9,6 +11,10 @@ import (
 	user_repository "github.com/shordem/api.thryvo/repository/user"
 )
 
+var ErrInvalidFolderParent = errors.New("a folder can't be moved into itself or one of its subfolders")
+
+// FolderServiceInterface manages folders on behalf of users with a role on them. Folders created in a
+// folder shared with the user belong to the owner of that folder.
 type FolderServiceInterface interface {
 	CreateFolder(folderDto dto.FolderDTO) (dto.FolderDTO, error)
 	FindFoldersByUserId(userId uuid.UUID) ([]dto.FolderDTO, error)
@@ -20,19 +26,26 @@ type FolderServiceInterface interface {
 type folderService struct {
 	folderRepository core_repository.FolderRepositoryInterface
 	userRepository   user_repository.UserRepositoryInterface
+	permissions      PermissionServiceInterface
 }
 
 func NewFolderService(
 	folderRepository core_repository.FolderRepositoryInterface,
 	userRepository user_repository.UserRepositoryInterface,
+	permissions PermissionServiceInterface,
 ) FolderServiceInterface {
 	return &folderService{
 		folderRepository: folderRepository,
 		userRepository:   userRepository,
+		permissions:      permissions,
 	}
 }
 
 func (f *folderService) ConvertToDTO(folder model.Folder) dto.FolderDTO {
+	return convertFolder(folder)
+}
+
+func convertFolder(folder model.Folder) dto.FolderDTO {
 	var folderDto dto.FolderDTO
 
 	folderDto.ID = folder.ID
@@ -42,6 +55,7 @@ func (f *folderService) ConvertToDTO(folder model.Folder) dto.FolderDTO {
 	folderDto.CreatedAt = folder.CreatedAt
 	folderDto.UpdatedAt = folder.UpdatedAt
 	folderDto.DeletedAt = folder.DeletedAt.Time
+	folderDto.Tags = convertTags(folder.Tags)
 
 	return folderDto
 }
@@ -61,6 +75,15 @@ func (f *folderService) ConvertToModel(folderDto dto.FolderDTO) model.Folder {
 }
 
 func (f *folderService) CreateFolder(folderDto dto.FolderDTO) (dto.FolderDTO, error) {
+	if folderDto.ParentID != nil {
+		parent, err := findFolder(f.folderRepository, f.permissions, *folderDto.ParentID, folderDto.UserID, PermissionRoleEditor)
+		if err != nil {
+			return dto.FolderDTO{}, err
+		}
+
+		folderDto.UserID = parent.UserID
+	}
+
 	folder := f.ConvertToModel(folderDto)
 
 	folder, err := f.folderRepository.CreateFolder(folder)
@@ -85,8 +108,14 @@ func (f *folderService) FindFoldersByUserId(userId uuid.UUID) ([]dto.FolderDTO,
 	return folderDtos, nil
 }
 
+// FindFoldersByParentId lists the subfolders of a folder the user can view
 func (f *folderService) FindFoldersByParentId(userId uuid.UUID, parentId uuid.UUID) ([]dto.FolderDTO, error) {
-	folders, err := f.folderRepository.FindFoldersByParentId(userId, parentId)
+	parent, err := findFolder(f.folderRepository, f.permissions, parentId, userId, PermissionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := f.folderRepository.FindFoldersByParentId(parent.UserID, parent.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -99,10 +128,32 @@ func (f *folderService) FindFoldersByParentId(userId uuid.UUID, parentId uuid.UU
 	return folderDtos, nil
 }
 
+// UpdateFolder renames and/or moves a folder for folderDto.UserID, who must be able to edit both the
+// folder and its new parent. A folder stays with its owner, so it can only move within their folders.
 func (f *folderService) UpdateFolder(folderDto dto.FolderDTO) (dto.FolderDTO, error) {
-	folder := f.ConvertToModel(folderDto)
+	folder, err := findFolder(f.folderRepository, f.permissions, folderDto.ID, folderDto.UserID, PermissionRoleEditor)
+	if err != nil {
+		return dto.FolderDTO{}, err
+	}
+
+	if folderDto.ParentID != nil && (folder.ParentID == nil || *folder.ParentID != *folderDto.ParentID) {
+		parent, err := findFolder(f.folderRepository, f.permissions, *folderDto.ParentID, folderDto.UserID, PermissionRoleEditor)
+		if err != nil {
+			return dto.FolderDTO{}, err
+		}
 
-	folder, err := f.folderRepository.UpdateFolder(folder)
+		if parent.UserID != folder.UserID {
+			return dto.FolderDTO{}, ErrFolderNotFound
+		}
+
+		if err := f.checkParent(folder, parent); err != nil {
+			return dto.FolderDTO{}, err
+		}
+	}
+
+	folderDto.UserID = folder.UserID
+
+	folder, err = f.folderRepository.UpdateFolder(f.ConvertToModel(folderDto))
 	if err != nil {
 		return dto.FolderDTO{}, err
 	}
@@ -110,6 +161,41 @@ func (f *folderService) UpdateFolder(folderDto dto.FolderDTO) (dto.FolderDTO, er
 	return f.ConvertToDTO(folder), nil
 }
 
+// DeleteFolder takes the owner role on the folder
 func (f *folderService) DeleteFolder(id uuid.UUID, userId uuid.UUID) error {
-	return f.folderRepository.DeleteFolder(id, userId)
+	folder, err := findFolder(f.folderRepository, f.permissions, id, userId, PermissionRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	return f.folderRepository.DeleteFolder(folder.ID, folder.UserID)
+}
+
+// checkParent makes sure moving folder into parent doesn't make it its own ancestor
+func (f *folderService) checkParent(folder model.Folder, parent model.Folder) error {
+	folders, err := f.folderRepository.FindFoldersByUserId(folder.UserID)
+	if err != nil {
+		return err
+	}
+
+	byId := map[uuid.UUID]model.Folder{}
+	for _, candidate := range folders {
+		byId[candidate.ID] = candidate
+	}
+
+	// the walk up is bounded by the number of folders in case the tree already has a cycle
+	current, ok := parent, true
+	for steps := 0; ok && steps <= len(folders); steps++ {
+		if current.ID == folder.ID {
+			return ErrInvalidFolderParent
+		}
+
+		if current.ParentID == nil {
+			break
+		}
+
+		current, ok = byId[*current.ParentID]
+	}
+
+	return nil
 }
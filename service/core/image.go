@@ -0,0 +1,208 @@
+package core_service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+)
+
+var (
+	// MaxImageDimension caps the width and height of a transformed image
+	MaxImageDimension = 4096
+	// MaxImageSourcePixels caps the size of images that are decoded for a transformation
+	MaxImageSourcePixels = 40_000_000
+	// MaxImageSourceSize caps the stored size of images that are decoded for a transformation
+	MaxImageSourceSize int64 = 50 * 1024 * 1024
+	// DefaultImageQuality is the JPEG quality used when none is asked for
+	DefaultImageQuality = 80
+	// MaxCachedTransforms caps how many transformations of the same content are cached, the oldest
+	// ones are evicted to make room for new ones
+	MaxCachedTransforms = 10
+)
+
+var (
+	ErrNotAnImage       = errors.New("only JPEG, PNG, GIF and WebP images can be transformed")
+	ErrInvalidTransform = fmt.Errorf("width and height must be between 1 and %d, fit must be contain, cover or fill, format must be jpeg, png or gif and quality must be between 1 and 100", MaxImageDimension)
+)
+
+// imageSourceFormats are the decodable types, mapped to the format their output defaults to
+var imageSourceFormats = map[string]string{
+	"image/jpeg": helper.ImageFormatJPEG,
+	"image/png":  helper.ImageFormatPNG,
+	"image/gif":  helper.ImageFormatGIF,
+	"image/webp": helper.ImageFormatPNG,
+}
+
+// imageTransform validates a transformation of a file with the given type and fills in the defaults
+func (f *fileService) imageTransform(transform dto.ImageTransformDTO, mimeType string) (helper.ImageTransform, error) {
+	format, ok := imageSourceFormats[strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))]
+	if !ok {
+		return helper.ImageTransform{}, ErrNotAnImage
+	}
+
+	result := helper.ImageTransform{
+		Width:   transform.Width,
+		Height:  transform.Height,
+		Fit:     strings.ToLower(transform.Fit),
+		Format:  strings.ToLower(transform.Format),
+		Quality: transform.Quality,
+	}
+
+	if result.Fit == "" {
+		result.Fit = helper.ImageFitContain
+	}
+
+	if result.Format == "jpg" {
+		result.Format = helper.ImageFormatJPEG
+	}
+
+	if result.Format == "" {
+		result.Format = format
+	}
+
+	if result.Quality == 0 {
+		result.Quality = DefaultImageQuality
+	}
+
+	switch {
+	case result.Width < 0 || result.Width > MaxImageDimension,
+		result.Height < 0 || result.Height > MaxImageDimension,
+		result.Fit != helper.ImageFitContain && result.Fit != helper.ImageFitCover && result.Fit != helper.ImageFitFill,
+		helper.ImageContentTypes[result.Format] == "",
+		result.Quality < 1 || result.Quality > 100:
+		return helper.ImageTransform{}, ErrInvalidTransform
+	}
+
+	// quality only affects JPEG output, leaving it out of the other keys lets them share a cache entry
+	if result.Format != helper.ImageFormatJPEG {
+		result.Quality = 0
+	}
+
+	return result, nil
+}
+
+// transformSpec identifies a transformation in cache keys and entity tags
+func transformSpec(transform helper.ImageTransform) string {
+	return fmt.Sprintf("%dx%d-%s-q%d.%s", transform.Width, transform.Height, transform.Fit, transform.Quality, transform.Format)
+}
+
+// keyContentId identifies content without a hash by the key and version of its file
+func keyContentId(key string, version int) string {
+	return fmt.Sprintf("%s-%d", key, version)
+}
+
+// transformsPath is the prefix the cached transformations of some content are stored under
+func (f *fileService) transformsPath(userId uuid.UUID, contentId string) string {
+	return f.fileConfig.GetObjectPath(userId.String(), "transforms/"+contentId+"/")
+}
+
+// removeTransforms deletes every cached transformation of some content
+func (f *fileService) removeTransforms(userId uuid.UUID, contentId string) error {
+	return f.fileConfig.ListObjects(f.transformsPath(userId, contentId), func(object dto.ListedObjectDTO) error {
+		return f.fileConfig.DeleteObject(object.Path)
+	})
+}
+
+// evictTransforms deletes the oldest cached transformations under prefix until there is room for one more
+func (f *fileService) evictTransforms(prefix string) error {
+	var cached []dto.ListedObjectDTO
+
+	err := f.fileConfig.ListObjects(prefix, func(object dto.ListedObjectDTO) error {
+		cached = append(cached, object)
+		return nil
+	})
+	if err != nil || len(cached) < MaxCachedTransforms {
+		return err
+	}
+
+	sort.Slice(cached, func(i, j int) bool { return cached[i].LastModified.Before(cached[j].LastModified) })
+
+	for _, object := range cached[:len(cached)-MaxCachedTransforms+1] {
+		if err := f.fileConfig.DeleteObject(object.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transformedObject returns where the transformed content of a file is cached and its size, producing
+// it from the source content when it isn't cached yet. contentId identifies the source content. The
+// cached copy is encrypted with the key of the source.
+func (f *fileService) transformedObject(file model.File, source storedContent, contentId string, transform helper.ImageTransform) (storedContent, int64, error) {
+	prefix := f.transformsPath(file.UserID, contentId)
+	cached := storedContent{
+		path: prefix + transformSpec(transform),
+		key:  source.key,
+	}
+
+	info, err := f.fileConfig.HeadObject(cached.path)
+	if err == nil {
+		if cached.key != nil {
+			return cached, helper.DecryptedSize(info.Size), nil
+		}
+
+		return cached, info.Size, nil
+	}
+
+	if !errors.Is(err, config.ErrObjectNotFound) {
+		return storedContent{}, 0, err
+	}
+
+	if file.Size > MaxImageSourceSize {
+		return storedContent{}, 0, helper.ErrImageTooLarge
+	}
+
+	object, err := openContent(f.fileConfig, source, file.Size, nil)
+	if err != nil {
+		return storedContent{}, 0, err
+	}
+	defer object.Body.Close()
+
+	output, err := helper.TransformImage(object.Body, transform, MaxImageSourcePixels)
+	if err != nil {
+		return storedContent{}, 0, err
+	}
+
+	size := int64(len(output))
+	var body io.Reader = bytes.NewReader(output)
+	storedSize := size
+
+	if cached.key != nil {
+		if body, err = helper.NewEncryptingReader(body, cached.key); err != nil {
+			return storedContent{}, 0, err
+		}
+
+		storedSize = helper.EncryptedSize(size)
+	}
+
+	if err := f.evictTransforms(prefix); err != nil {
+		return storedContent{}, 0, err
+	}
+
+	if err := f.fileConfig.PutObject(cached.path, body, storedSize, helper.ImageContentTypes[transform.Format]); err != nil {
+		return storedContent{}, 0, err
+	}
+
+	return cached, size, nil
+}
+
+// transformedName swaps the extension of a file name for the one of the output format
+func transformedName(name string, format string) string {
+	if format == helper.ImageFormatJPEG {
+		format = "jpg"
+	}
+
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + format
+}
@@ -0,0 +1,79 @@
+package core_service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/model"
+)
+
+var (
+	// MaxMetadataKeys caps how many key-value pairs a file can carry
+	MaxMetadataKeys = 50
+	// MaxMetadataSize caps the size of a file's metadata encoded as JSON, in bytes
+	MaxMetadataSize = 8 * 1024
+)
+
+var ErrInvalidMetadata = fmt.Errorf("metadata can have at most %d keys and %d bytes, keys must be 1 to 64 letters, digits, '_', '-' or '.'", MaxMetadataKeys, MaxMetadataSize)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidateMetadata checks the keys and the size of file metadata
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataKeys {
+		return ErrInvalidMetadata
+	}
+
+	for key := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return ErrInvalidMetadata
+		}
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil || len(encoded) > MaxMetadataSize {
+		return ErrInvalidMetadata
+	}
+
+	return nil
+}
+
+// UpdateMetadata merges changes into a file's metadata, a nil value removes its key
+func (f *fileService) UpdateMetadata(id uuid.UUID, userId uuid.UUID, changes map[string]*string) (dto.FileDTO, error) {
+	file, err := f.findFile(id, userId, PermissionRoleEditor)
+	if err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	metadata := model.Metadata{}
+	for key, value := range file.Metadata {
+		metadata[key] = value
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(metadata, key)
+		} else {
+			metadata[key] = *value
+		}
+	}
+
+	if err := ValidateMetadata(metadata); err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	if err := f.fileRepository.UpdateFileMetadata(file.ID, metadata); err != nil {
+		return dto.FileDTO{}, err
+	}
+
+	file.Metadata = metadata
+
+	fileDto := f.ConvertToDTO(file)
+	fileDto.Path = f.fileConfig.GetObjectPath(file.UserID.String(), file.Key)
+
+	return fileDto, nil
+}
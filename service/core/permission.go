@@ -0,0 +1,467 @@
+package core_service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+	user_repository "github.com/shordem/api.thryvo/repository/user"
+	"github.com/shordem/api.thryvo/service"
+)
+
+// Roles other users can be given on a file or folder. Viewers can list and download, editors can
+// also upload, rename and change content, owners can do everything the owner can, including deleting
+// and sharing. A role on a folder applies to everything below it.
+var (
+	PermissionRoleViewer = "viewer"
+	PermissionRoleEditor = "editor"
+	PermissionRoleOwner  = "owner"
+)
+
+var permissionRoleRanks = map[string]int{
+	PermissionRoleViewer: 1,
+	PermissionRoleEditor: 2,
+	PermissionRoleOwner:  3,
+}
+
+var (
+	ErrPermissionNotFound      = errors.New("permission not found")
+	ErrFolderAccessDenied      = errors.New("you do not have access to this folder")
+	ErrInvalidPermissionRole   = errors.New("role must be viewer, editor or owner")
+	ErrInvalidPermissionTarget = errors.New("a permission is given on either a file or a folder")
+	ErrShareUserNotFound       = errors.New("no user has this email address")
+	ErrInvalidShareUser        = errors.New("items can't be shared with their owner or with yourself")
+)
+
+// RoleAllows reports whether role is at least required
+func RoleAllows(role string, required string) bool {
+	return permissionRoleRanks[role] > 0 && permissionRoleRanks[role] >= permissionRoleRanks[required]
+}
+
+func strongerRole(role string, other string) string {
+	if permissionRoleRanks[other] > permissionRoleRanks[role] {
+		return other
+	}
+
+	return role
+}
+
+type PermissionServiceInterface interface {
+	// GrantPermission shares a file or folder with the user with the email address, changing their role
+	// when it already is shared with them. It takes the owner role on the item.
+	GrantPermission(userId uuid.UUID, grant dto.GrantPermissionDTO) (dto.PermissionDTO, error)
+	// FindPermissions lists who a file or folder is shared with, it takes the owner role on the item
+	FindPermissions(userId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) ([]dto.PermissionDTO, error)
+	UpdatePermission(id uuid.UUID, userId uuid.UUID, role string) (dto.PermissionDTO, error)
+	// RevokePermission takes the owner role on the item, unless users give up their own permission
+	RevokePermission(id uuid.UUID, userId uuid.UUID) error
+	// FindSharedWithMe lists the files and folders other users shared with the user
+	FindSharedWithMe(userId uuid.UUID) ([]dto.SharedItemDTO, error)
+	// FileRole is the strongest role the user has on the file, as its owner or through a permission on
+	// it or on any folder above it. It is empty when they have none.
+	FileRole(userId uuid.UUID, file model.File) (string, error)
+	// FolderRole is the strongest role the user has on the folder, empty when they have none
+	FolderRole(userId uuid.UUID, folder model.Folder) (string, error)
+}
+
+type permissionService struct {
+	permissionRepository core_repository.PermissionRepositoryInterface
+	fileRepository       core_repository.FileRepositoryInterface
+	folderRepository     core_repository.FolderRepositoryInterface
+	userRepository       user_repository.UserRepositoryInterface
+	fileConfig           config.FileConfigInterface
+	mail                 service.EmailServiceInterface
+}
+
+func NewPermissionService(
+	permissionRepository core_repository.PermissionRepositoryInterface,
+	fileRepository core_repository.FileRepositoryInterface,
+	folderRepository core_repository.FolderRepositoryInterface,
+	userRepository user_repository.UserRepositoryInterface,
+	fileConfig config.FileConfigInterface,
+	mail service.EmailServiceInterface,
+) PermissionServiceInterface {
+	return &permissionService{
+		permissionRepository: permissionRepository,
+		fileRepository:       fileRepository,
+		folderRepository:     folderRepository,
+		userRepository:       userRepository,
+		fileConfig:           fileConfig,
+		mail:                 mail,
+	}
+}
+
+func (p *permissionService) ConvertToDTO(permission model.Permission) dto.PermissionDTO {
+	var permissionDto dto.PermissionDTO
+
+	permissionDto.ID = permission.ID
+	permissionDto.OwnerID = permission.OwnerID
+	permissionDto.UserID = permission.UserID
+	if permission.User != nil {
+		permissionDto.Email = permission.User.Email
+	}
+	permissionDto.FileID = permission.FileID
+	permissionDto.FolderID = permission.FolderID
+	permissionDto.Role = permission.Role
+	permissionDto.CreatedAt = permission.CreatedAt
+	permissionDto.UpdatedAt = permission.UpdatedAt
+
+	return permissionDto
+}
+
+func (p *permissionService) GrantPermission(userId uuid.UUID, grant dto.GrantPermissionDTO) (dto.PermissionDTO, error) {
+	if _, ok := permissionRoleRanks[grant.Role]; !ok {
+		return dto.PermissionDTO{}, ErrInvalidPermissionRole
+	}
+
+	ownerId, name, err := p.findSharedItem(userId, grant.FileID, grant.FolderID)
+	if err != nil {
+		return dto.PermissionDTO{}, err
+	}
+
+	user, err := p.userRepository.FindUserByEmail(strings.TrimSpace(grant.Email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.PermissionDTO{}, ErrShareUserNotFound
+		}
+
+		return dto.PermissionDTO{}, err
+	}
+
+	if user.ID == ownerId || user.ID == userId {
+		return dto.PermissionDTO{}, ErrInvalidShareUser
+	}
+
+	permission, err := p.permissionRepository.FindPermission(user.ID, grant.FileID, grant.FolderID)
+	if err == nil {
+		if err := p.permissionRepository.UpdatePermissionRole(permission.ID, grant.Role); err != nil {
+			return dto.PermissionDTO{}, err
+		}
+
+		permission.Role = grant.Role
+		permission.UpdatedAt = time.Now()
+
+		return p.ConvertToDTO(permission), nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return dto.PermissionDTO{}, err
+	}
+
+	permission, err = p.permissionRepository.CreatePermission(model.Permission{
+		OwnerID:   ownerId,
+		UserID:    user.ID,
+		FileID:    grant.FileID,
+		FolderID:  grant.FolderID,
+		Role:      grant.Role,
+		GrantedBy: &userId,
+	})
+	if err != nil {
+		return dto.PermissionDTO{}, err
+	}
+
+	permission.User = &user
+
+	p.notifyUser(userId, user, name, grant.Role)
+
+	return p.ConvertToDTO(permission), nil
+}
+
+func (p *permissionService) FindPermissions(userId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) ([]dto.PermissionDTO, error) {
+	if _, _, err := p.findSharedItem(userId, fileId, folderId); err != nil {
+		return nil, err
+	}
+
+	permissions, err := p.permissionRepository.FindPermissionsByItem(fileId, folderId)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionsDto := []dto.PermissionDTO{}
+	for _, permission := range permissions {
+		permissionsDto = append(permissionsDto, p.ConvertToDTO(permission))
+	}
+
+	return permissionsDto, nil
+}
+
+func (p *permissionService) UpdatePermission(id uuid.UUID, userId uuid.UUID, role string) (dto.PermissionDTO, error) {
+	if _, ok := permissionRoleRanks[role]; !ok {
+		return dto.PermissionDTO{}, ErrInvalidPermissionRole
+	}
+
+	permission, err := p.findPermission(id)
+	if err != nil {
+		return dto.PermissionDTO{}, err
+	}
+
+	if err := p.manages(userId, permission); err != nil {
+		return dto.PermissionDTO{}, err
+	}
+
+	if err := p.permissionRepository.UpdatePermissionRole(permission.ID, role); err != nil {
+		return dto.PermissionDTO{}, err
+	}
+
+	permission.Role = role
+	permission.UpdatedAt = time.Now()
+
+	return p.ConvertToDTO(permission), nil
+}
+
+func (p *permissionService) RevokePermission(id uuid.UUID, userId uuid.UUID) error {
+	permission, err := p.findPermission(id)
+	if err != nil {
+		return err
+	}
+
+	if permission.UserID != userId {
+		if err := p.manages(userId, permission); err != nil {
+			return err
+		}
+	}
+
+	return p.permissionRepository.DeletePermission(permission.ID)
+}
+
+func (p *permissionService) FindSharedWithMe(userId uuid.UUID) ([]dto.SharedItemDTO, error) {
+	permissions, err := p.permissionRepository.FindPermissionsByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []dto.SharedItemDTO{}
+	for _, permission := range permissions {
+		item := dto.SharedItemDTO{
+			PermissionID: permission.ID,
+			Role:         permission.Role,
+			OwnerID:      permission.OwnerID,
+			SharedAt:     permission.CreatedAt,
+		}
+
+		if permission.Owner != nil {
+			item.OwnerEmail = permission.Owner.Email
+		}
+
+		switch {
+		case permission.File != nil:
+			// trashed and expired files are gone for everyone they were shared with
+			if permission.File.ExpiresAt != nil && !permission.File.ExpiresAt.After(time.Now()) {
+				continue
+			}
+
+			fileDto := convertFile(*permission.File)
+			fileDto.UserID = permission.File.UserID
+			fileDto.FolderID = permission.File.FolderID
+			fileDto.Path = p.fileConfig.GetObjectPath(permission.File.UserID.String(), permission.File.Key)
+			item.File = &fileDto
+		case permission.Folder != nil:
+			folderDto := convertFolder(*permission.Folder)
+			item.Folder = &folderDto
+		default:
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (p *permissionService) FileRole(userId uuid.UUID, file model.File) (string, error) {
+	if file.UserID == userId {
+		return PermissionRoleOwner, nil
+	}
+
+	return p.role(userId, file.UserID, &file.ID, file.FolderID)
+}
+
+func (p *permissionService) FolderRole(userId uuid.UUID, folder model.Folder) (string, error) {
+	if folder.UserID == userId {
+		return PermissionRoleOwner, nil
+	}
+
+	return p.role(userId, folder.UserID, nil, &folder.ID)
+}
+
+// role is the strongest role the user's permissions from the owner give on fileId, or on folderId and
+// the folders above it
+func (p *permissionService) role(userId uuid.UUID, ownerId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) (string, error) {
+	permissions, err := p.permissionRepository.FindPermissionsFromOwner(ownerId, userId)
+	if err != nil || len(permissions) == 0 {
+		return "", err
+	}
+
+	role := ""
+	folderRoles := map[uuid.UUID]string{}
+
+	for _, permission := range permissions {
+		switch {
+		case permission.FileID != nil && fileId != nil && *permission.FileID == *fileId:
+			role = strongerRole(role, permission.Role)
+		case permission.FolderID != nil:
+			folderRoles[*permission.FolderID] = strongerRole(folderRoles[*permission.FolderID], permission.Role)
+		}
+	}
+
+	if folderId == nil || len(folderRoles) == 0 {
+		return role, nil
+	}
+
+	folders, err := p.folderRepository.FindFoldersByUserId(ownerId)
+	if err != nil {
+		return "", err
+	}
+
+	byId := map[uuid.UUID]model.Folder{}
+	for _, folder := range folders {
+		byId[folder.ID] = folder
+	}
+
+	current, ok := byId[*folderId]
+
+	// the walk up is bounded by the number of folders in case the tree has a cycle
+	for steps := 0; ok && steps <= len(folders); steps++ {
+		role = strongerRole(role, folderRoles[current.ID])
+
+		if current.ParentID == nil {
+			break
+		}
+
+		current, ok = byId[*current.ParentID]
+	}
+
+	return role, nil
+}
+
+// findSharedItem checks that the user has the owner role on the file or folder, returning who really
+// owns it and its name
+func (p *permissionService) findSharedItem(userId uuid.UUID, fileId *uuid.UUID, folderId *uuid.UUID) (uuid.UUID, string, error) {
+	if (fileId == nil) == (folderId == nil) {
+		return uuid.Nil, "", ErrInvalidPermissionTarget
+	}
+
+	if fileId != nil {
+		file, err := findFile(p.fileRepository, p, *fileId, userId, PermissionRoleOwner)
+		if err != nil {
+			return uuid.Nil, "", err
+		}
+
+		return file.UserID, file.OriginalName, nil
+	}
+
+	folder, err := findFolder(p.folderRepository, p, *folderId, userId, PermissionRoleOwner)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return folder.UserID, folder.Name, nil
+}
+
+// manages checks that the user has the owner role on the item of the permission, permissions on items
+// they can't see at all are reported as not found
+func (p *permissionService) manages(userId uuid.UUID, permission model.Permission) error {
+	_, _, err := p.findSharedItem(userId, permission.FileID, permission.FolderID)
+	if errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrFolderNotFound) {
+		return ErrPermissionNotFound
+	}
+
+	return err
+}
+
+func (p *permissionService) findPermission(id uuid.UUID) (model.Permission, error) {
+	permission, err := p.permissionRepository.FindPermissionById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Permission{}, ErrPermissionNotFound
+		}
+
+		return model.Permission{}, err
+	}
+
+	return permission, nil
+}
+
+// notifyUser emails the user that something was shared with them, failing to do so doesn't undo the share
+func (p *permissionService) notifyUser(sharedBy uuid.UUID, user model.User, name string, role string) {
+	sharer, err := p.userRepository.FindUserById(sharedBy)
+	if err != nil {
+		return
+	}
+
+	_ = p.mail.SendEmail(service.SendEmailParams{
+		To:       user.Email,
+		Subject:  sharer.FirstName + " shared \"" + name + "\" with you on FileCapsa",
+		Template: "item-shared",
+		Variables: map[string]interface{}{
+			"FullName":      user.FirstName + " " + user.LastName,
+			"SharedBy":      sharer.FirstName + " " + sharer.LastName,
+			"SharedByEmail": sharer.Email,
+			"Name":          name,
+			"Role":          role,
+		},
+	})
+}
+
+// findFile returns the file when the user has at least role on it. Files they have no role on at all
+// are reported as not found.
+func findFile(fileRepository core_repository.FileRepositoryInterface, permissions PermissionServiceInterface, id uuid.UUID, userId uuid.UUID, role string) (model.File, error) {
+	file, err := fileRepository.FindFileById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.File{}, ErrFileNotFound
+		}
+
+		return model.File{}, err
+	}
+
+	granted, err := permissions.FileRole(userId, file)
+	if err != nil {
+		return model.File{}, err
+	}
+
+	if granted == "" {
+		return model.File{}, ErrFileNotFound
+	}
+
+	if !RoleAllows(granted, role) {
+		return model.File{}, ErrFileAccessDenied
+	}
+
+	return file, nil
+}
+
+// findFolder returns the folder when the user has at least role on it. Folders they have no role on at
+// all are reported as not found.
+func findFolder(folderRepository core_repository.FolderRepositoryInterface, permissions PermissionServiceInterface, id uuid.UUID, userId uuid.UUID, role string) (model.Folder, error) {
+	folder, err := folderRepository.FindFolderById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Folder{}, ErrFolderNotFound
+		}
+
+		return model.Folder{}, err
+	}
+
+	granted, err := permissions.FolderRole(userId, folder)
+	if err != nil {
+		return model.Folder{}, err
+	}
+
+	if granted == "" {
+		return model.Folder{}, ErrFolderNotFound
+	}
+
+	if !RoleAllows(granted, role) {
+		return model.Folder{}, ErrFolderAccessDenied
+	}
+
+	return folder, nil
+}
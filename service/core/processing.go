@@ -0,0 +1,126 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+)
+
+const (
+	// ProcessingStatusPending marks a file whose content the client put in storage directly, it is served
+	// from its key until it has been copied to a key of our own
+	ProcessingStatusPending = "pending"
+	ProcessingStatusReady   = "ready"
+)
+
+var (
+	ErrContentChanged = errors.New("the uploaded content changed after the upload was finalized")
+	ErrFileProcessing = errors.New("the file is still being processed, try again in a minute")
+)
+
+// processingBatchSize bounds how many files a single processing run loads at once
+const processingBatchSize = 20
+
+// ProcessPendingFiles stores a copy of the content of pending files as blobs like that of any other
+// upload, encrypted when encryption is on. Markup carrying script that a script only rule blocks is removed
+// along with its file.
+func (f *fileService) ProcessPendingFiles(ctx context.Context) error {
+	for {
+		files, err := f.fileRepository.FindFilesByProcessingStatus(ProcessingStatusPending, processingBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := f.processFile(file); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < processingBatchSize {
+			return nil
+		}
+	}
+}
+
+// processFile turns the content of one pending file into a blob. Content that is gone, blocked or was
+// changed after the upload was finalized is removed with its file, any other error leaves it pending
+// for the next run.
+func (f *fileService) processFile(file model.File) error {
+	stored, err := f.processContent(file)
+
+	switch {
+	case errors.Is(err, config.ErrObjectNotFound),
+		errors.Is(err, ErrContentChanged),
+		errors.Is(err, ErrContentTypeBlocked),
+		errors.Is(err, ErrContentTypeNotAllowed),
+		errors.Is(err, ErrContentTypeMismatch):
+		return f.purge(file, f.fileRepository.DeletePendingFile)
+	case err != nil:
+		return err
+	}
+
+	blob, err := f.storeBlob(file.UserID, stored)
+	if err != nil {
+		return err
+	}
+
+	completed, err := f.fileRepository.CompleteProcessing(file.ID, blob.ID, stored.Hash, stored.MD5, stored.Size)
+	if err != nil || !completed {
+		f.releaseBlob(blob.ID)
+		return err
+	}
+
+	// the copy replaces the object the client uploaded
+	if err := f.fileConfig.DeleteObject(f.fileConfig.GetObjectPath(file.UserID.String(), file.Key)); err != nil {
+		return err
+	}
+
+	// transformations cached while the content had no hash yet are keyed by the file's key
+	return f.removeTransforms(file.UserID, keyContentId(file.Key, 1))
+}
+
+// processContent copies a pending file's content to a key of our own, hashing and encrypting it on the
+// way. The presigned URL can still overwrite the uploaded object, so only the copy is checked and kept
+// and it must still have the size and type the upload was finalized with.
+func (f *fileService) processContent(file model.File) (dto.StoredObjectDTO, error) {
+	object, err := f.fileConfig.GetObject(f.fileConfig.GetObjectPath(file.UserID.String(), file.Key), nil)
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+	defer object.Body.Close()
+
+	head, body, err := helper.PeekHead(helper.NewLimitedReaderError(object.Body, file.Size, ErrContentChanged))
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+
+	mimeType, err := f.contentTypes.ResolveContentType(file.UserID, file.MimeType, head)
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+
+	if mimeType != file.MimeType {
+		return dto.StoredObjectDTO{}, ErrContentChanged
+	}
+
+	stored, err := f.storeObject(file.UserID, file.OriginalName, file.MimeType, body)
+	if err != nil {
+		return dto.StoredObjectDTO{}, err
+	}
+
+	if stored.Size != file.Size {
+		f.fileConfig.DeleteObject(f.fileConfig.GetObjectPath(file.UserID.String(), stored.Key))
+		return dto.StoredObjectDTO{}, ErrContentChanged
+	}
+
+	return stored, nil
+}
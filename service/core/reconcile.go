@@ -0,0 +1,192 @@
+package core_service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/model"
+	"github.com/shordem/api.thryvo/repository"
+)
+
+var (
+	// ReconcileGracePeriod spares objects and files changed recently, an upload may not have recorded its row yet
+	ReconcileGracePeriod = 24 * time.Hour
+	// MaxReconcileReportItems caps how many orphans, dangling files and errors a report lists
+	MaxReconcileReportItems = 1000
+)
+
+// reconcileUserBatchSize bounds how many users a reconciliation loads at once
+const reconcileUserBatchSize = 100
+
+// ReconcileStorage compares the objects below every user's prefix with the rows referring to them.
+// Objects nothing refers to are orphans, files whose current content is missing are dangling. Unless
+// dryRun is set orphans are deleted and dangling files with no version left in storage are purged.
+func (f *fileService) ReconcileStorage(ctx context.Context, dryRun bool) (dto.ReconcileReportDTO, error) {
+	report := dto.ReconcileReportDTO{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Orphans:   []dto.ListedObjectDTO{},
+		Dangling:  []dto.DanglingFileDTO{},
+		Errors:    []string{},
+	}
+
+	pageable := repository.Pageable{Page: 1, Size: reconcileUserBatchSize, SortBy: "created_at", SortDirection: "asc"}
+
+	for {
+		users, pagination, err := f.userRepository.FindAllUsers(pageable)
+		if err != nil {
+			return report, err
+		}
+
+		for _, user := range users {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+
+			if err := f.reconcileUser(user.ID, dryRun, &report); err != nil {
+				return report, err
+			}
+
+			report.UsersScanned++
+		}
+
+		if int64(pageable.Page) >= pagination.TotalPages {
+			break
+		}
+
+		pageable.Page++
+	}
+
+	report.FinishedAt = time.Now()
+
+	return report, nil
+}
+
+func (f *fileService) reconcileUser(userId uuid.UUID, dryRun bool, report *dto.ReconcileReportDTO) error {
+	cutoff := time.Now().Add(-ReconcileGracePeriod)
+	prefix := f.fileConfig.GetObjectPath(userId.String(), "")
+	transformsPrefix := f.fileConfig.GetObjectPath(userId.String(), "transforms/")
+
+	references, err := f.fileRepository.FindStorageReferences(userId)
+	if err != nil {
+		return err
+	}
+
+	referenced := map[string]bool{}
+	for _, path := range references.Paths {
+		referenced[path] = true
+	}
+
+	for _, key := range references.Keys {
+		referenced[f.fileConfig.GetObjectPath(userId.String(), key)] = true
+	}
+
+	contentIds := map[string]bool{}
+	for _, contentId := range references.ContentIDs {
+		contentIds[contentId] = true
+	}
+
+	stored := map[string]bool{}
+
+	err = f.fileConfig.ListObjects(prefix, func(object dto.ListedObjectDTO) error {
+		report.ObjectsScanned++
+		stored[object.Path] = true
+
+		if referenced[object.Path] || object.LastModified.After(cutoff) {
+			return nil
+		}
+
+		// cached transformations live as long as the content they were made from
+		if rest, found := strings.CutPrefix(object.Path, transformsPrefix); found {
+			if contentId, _, _ := strings.Cut(rest, "/"); contentIds[contentId] {
+				return nil
+			}
+		}
+
+		report.OrphanedObjects++
+		report.OrphanedBytes += object.Size
+		if len(report.Orphans) < MaxReconcileReportItems {
+			report.Orphans = append(report.Orphans, object)
+		}
+
+		if dryRun {
+			return nil
+		}
+
+		if err := f.fileConfig.DeleteObject(object.Path); err != nil {
+			addReconcileError(report, fmt.Sprintf("delete %s: %s", object.Path, err))
+			return nil
+		}
+
+		report.ObjectsDeleted++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	files, err := f.fileRepository.FindFilesWithContent(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.UpdatedAt.After(cutoff) {
+			continue
+		}
+
+		path := f.fileConfig.GetObjectPath(userId.String(), file.Key)
+		if file.BlobID != nil {
+			// the blob row itself may be gone, which leaves nothing to serve either
+			path = ""
+			if file.Blob != nil {
+				path = file.Blob.Path
+			}
+		}
+
+		if stored[path] {
+			continue
+		}
+
+		dangling := dto.DanglingFileDTO{ID: file.ID, UserID: file.UserID, OriginalName: file.OriginalName, Path: path}
+
+		if !dryRun && !versionStored(file, stored) {
+			if err := f.purge(file, f.fileRepository.PurgeFile); err != nil {
+				addReconcileError(report, fmt.Sprintf("purge file %s: %s", file.ID, err))
+			} else {
+				dangling.Purged = true
+				report.FilesPurged++
+			}
+		}
+
+		report.DanglingFiles++
+		if len(report.Dangling) < MaxReconcileReportItems {
+			report.Dangling = append(report.Dangling, dangling)
+		}
+	}
+
+	return nil
+}
+
+// versionStored reports whether any version of the file still has its content in storage
+func versionStored(file model.File, stored map[string]bool) bool {
+	for _, version := range file.Versions {
+		if version.Blob != nil && stored[version.Blob.Path] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addReconcileError(report *dto.ReconcileReportDTO, message string) {
+	if len(report.Errors) < MaxReconcileReportItems {
+		report.Errors = append(report.Errors, message)
+	}
+}
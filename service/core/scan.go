@@ -0,0 +1,177 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+	user_repository "github.com/shordem/api.thryvo/repository/user"
+	"github.com/shordem/api.thryvo/service"
+)
+
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	// ScanStatusFailed marks content the scanner couldn't scan, how it is served depends on ScanFailurePolicy
+	ScanStatusFailed = "failed"
+)
+
+const (
+	ScanFailureServe      = "serve"
+	ScanFailureQuarantine = "quarantine"
+)
+
+// ScanFailurePolicy decides what happens to content the scanner couldn't scan, such as content over the
+// scanner's size limit. It is served like clean content by default, which fails open.
+var ScanFailurePolicy = ScanFailureServe
+
+// scanBatchSize bounds how many blobs a single scan run loads at once
+const scanBatchSize = 20
+
+var ErrFileQuarantined = errors.New("this file was found to contain malware and is quarantined")
+
+type MalwareScanServiceInterface interface {
+	// ScanPendingContent scans all content stored since the last run. Infected content is quarantined,
+	// the files holding it can't be downloaded anymore and their owner is emailed about them.
+	ScanPendingContent(ctx context.Context) error
+}
+
+type malwareScanService struct {
+	scanner        config.ScannerInterface
+	fileConfig     config.FileConfigInterface
+	blobRepository core_repository.BlobRepositoryInterface
+	fileRepository core_repository.FileRepositoryInterface
+	userRepository user_repository.UserRepositoryInterface
+	encryption     EncryptionServiceInterface
+	mail           service.EmailServiceInterface
+}
+
+func NewMalwareScanService(
+	scanner config.ScannerInterface,
+	fileConfig config.FileConfigInterface,
+	blobRepository core_repository.BlobRepositoryInterface,
+	fileRepository core_repository.FileRepositoryInterface,
+	userRepository user_repository.UserRepositoryInterface,
+	encryption EncryptionServiceInterface,
+	mail service.EmailServiceInterface,
+) MalwareScanServiceInterface {
+	return &malwareScanService{
+		scanner:        scanner,
+		fileConfig:     fileConfig,
+		blobRepository: blobRepository,
+		fileRepository: fileRepository,
+		userRepository: userRepository,
+		encryption:     encryption,
+		mail:           mail,
+	}
+}
+
+func (s *malwareScanService) ScanPendingContent(ctx context.Context) error {
+	for {
+		blobs, err := s.blobRepository.FindBlobsByScanStatus(ScanStatusPending, scanBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := s.scan(ctx, blob); err != nil {
+				return err
+			}
+		}
+
+		if len(blobs) < scanBatchSize {
+			return nil
+		}
+	}
+}
+
+// scan records the outcome of scanning one blob. Content that can't be read or scanned is marked as
+// failed so it doesn't hold up the rest, any other error leaves it pending for the next run.
+func (s *malwareScanService) scan(ctx context.Context, blob model.Blob) error {
+	result, err := s.scanContent(ctx, blob)
+
+	switch {
+	case errors.Is(err, config.ErrObjectNotFound),
+		errors.Is(err, config.ErrScanFailed),
+		errors.Is(err, helper.ErrDecryptionFailed),
+		errors.Is(err, ErrMasterKeyMissing):
+		return s.blobRepository.UpdateScanResult(blob.ID, ScanStatusFailed, "")
+	case err != nil:
+		return err
+	case !result.Infected:
+		return s.blobRepository.UpdateScanResult(blob.ID, ScanStatusClean, "")
+	}
+
+	if err := s.blobRepository.UpdateScanResult(blob.ID, ScanStatusInfected, result.Signature); err != nil {
+		return err
+	}
+
+	return s.notifyOwner(blob.UserID, blob.ID, result.Signature)
+}
+
+// quarantined reports whether content in the given scan status must not be served
+func quarantined(scanStatus string) bool {
+	return scanStatus == ScanStatusInfected || (scanStatus == ScanStatusFailed && ScanFailurePolicy == ScanFailureQuarantine)
+}
+
+func (s *malwareScanService) scanContent(ctx context.Context, blob model.Blob) (dto.ScanResultDTO, error) {
+	key, err := s.encryption.DataKey(blob.UserID, blob.WrappedKey)
+	if err != nil {
+		return dto.ScanResultDTO{}, err
+	}
+
+	object, err := openContent(s.fileConfig, storedContent{path: blob.Path, key: key}, blob.Size, nil)
+	if err != nil {
+		return dto.ScanResultDTO{}, err
+	}
+	defer object.Body.Close()
+
+	return s.scanner.Scan(ctx, object.Body)
+}
+
+// notifyOwner emails the owner of quarantined content which of their files hold it
+func (s *malwareScanService) notifyOwner(userId uuid.UUID, blobId uuid.UUID, signature string) error {
+	files, err := s.fileRepository.FindFilesByBlob(blobId)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	user, err := s.userRepository.FindUserById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.OriginalName)
+	}
+
+	_ = s.mail.SendEmail(service.SendEmailParams{
+		To:       user.Email,
+		Subject:  "Some of your FileCapsa files were quarantined",
+		Template: "file-quarantined",
+		Variables: map[string]interface{}{
+			"FullName":  user.FirstName + " " + user.LastName,
+			"Files":     names,
+			"Signature": signature,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/database"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+	user_repository "github.com/shordem/api.thryvo/repository/user"
+	"github.com/shordem/api.thryvo/service"
+)
+
+// the fakes embed the interfaces they stand in for, so calling anything the test didn't expect panics
+
+type fakeBlobRepository struct {
+	core_repository.BlobRepositoryInterface
+	blobs map[uuid.UUID]*model.Blob
+}
+
+func (b *fakeBlobRepository) FindBlobById(id uuid.UUID) (model.Blob, error) {
+	return *b.blobs[id], nil
+}
+
+func (b *fakeBlobRepository) FindBlobsByScanStatus(status string, limit int) ([]model.Blob, error) {
+	blobs := []model.Blob{}
+	for _, blob := range b.blobs {
+		if blob.ScanStatus == status && len(blobs) < limit {
+			blobs = append(blobs, *blob)
+		}
+	}
+
+	return blobs, nil
+}
+
+func (b *fakeBlobRepository) UpdateScanResult(id uuid.UUID, status string, signature string) error {
+	b.blobs[id].ScanStatus = status
+	b.blobs[id].ScanSignature = signature
+
+	return nil
+}
+
+type fakeFileRepository struct {
+	core_repository.FileRepositoryInterface
+	file model.File
+}
+
+func (f *fakeFileRepository) FindFileByKeyName(keyName string) (model.File, error) {
+	return f.file, nil
+}
+
+func (f *fakeFileRepository) FindFilesByBlob(blobId uuid.UUID) ([]model.File, error) {
+	return []model.File{f.file}, nil
+}
+
+type fakeUserRepository struct {
+	user_repository.UserRepositoryInterface
+	user model.User
+}
+
+func (u *fakeUserRepository) FindUserById(id uuid.UUID) (model.User, error) {
+	return u.user, nil
+}
+
+type fakeEmailService struct {
+	sent []service.SendEmailParams
+}
+
+func (e *fakeEmailService) SendEmail(params service.SendEmailParams) error {
+	e.sent = append(e.sent, params)
+
+	return nil
+}
+
+type fakeScanner struct {
+	result dto.ScanResultDTO
+	err    error
+}
+
+func (s *fakeScanner) Scan(ctx context.Context, body io.Reader) (dto.ScanResultDTO, error) {
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return dto.ScanResultDTO{}, err
+	}
+
+	return s.result, s.err
+}
+
+type scanFixture struct {
+	blobs       *fakeBlobRepository
+	mail        *fakeEmailService
+	scanService MalwareScanServiceInterface
+	fileService FileServiceInterface
+	file        model.File
+}
+
+func newScanFixture(t *testing.T, scanner config.ScannerInterface) scanFixture {
+	t.Helper()
+
+	content := "X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"
+	userId := uuid.New()
+	blob := &model.Blob{
+		BaseModel:  database.BaseModel{ID: uuid.New()},
+		UserID:     userId,
+		Path:       userId.String() + "/blobs/eicar",
+		Size:       int64(len(content)),
+		ScanStatus: ScanStatusPending,
+	}
+	file := model.File{
+		BaseModel:    database.BaseModel{ID: uuid.New()},
+		UserID:       userId,
+		OriginalName: "eicar.txt",
+		Key:          "eicar.txt",
+		MimeType:     "text/plain",
+		Size:         blob.Size,
+		Version:      1,
+		BlobID:       &blob.ID,
+	}
+
+	fileConfig := config.NewFileConfigWithDriver(config.NewMemoryStorage())
+	if err := fileConfig.PutObject(blob.Path, strings.NewReader(content), blob.Size, file.MimeType); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := &fakeBlobRepository{blobs: map[uuid.UUID]*model.Blob{blob.ID: blob}}
+	files := &fakeFileRepository{file: file}
+	users := &fakeUserRepository{user: model.User{Email: "owner@example.com"}}
+	encryption := NewEncryptionService(nil, "", nil)
+	mail := &fakeEmailService{}
+
+	return scanFixture{
+		blobs:       blobs,
+		mail:        mail,
+		scanService: NewMalwareScanService(scanner, fileConfig, blobs, files, users, encryption, mail),
+		fileService: NewFileService(fileConfig, files, nil, blobs, nil, users, nil, nil, nil, nil, encryption, nil),
+		file:        file,
+	}
+}
+
+func (f scanFixture) getFile() (dto.GetFileDTO, error) {
+	return f.fileService.GetFile(f.file.UserID.String(), f.file.Key, dto.FileAccessDTO{Granted: true}, dto.FileConditionsDTO{})
+}
+
+func TestScanPendingContentQuarantinesInfectedContent(t *testing.T) {
+	fixture := newScanFixture(t, &fakeScanner{result: dto.ScanResultDTO{Infected: true, Signature: "Eicar-Signature"}})
+
+	pending, err := fixture.getFile()
+	if err != nil {
+		t.Fatalf("pending content should be served, got %v", err)
+	}
+	pending.Body.Close()
+
+	if err := fixture.scanService.ScanPendingContent(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := fixture.blobs.blobs[*fixture.file.BlobID]
+	if blob.ScanStatus != ScanStatusInfected || blob.ScanSignature != "Eicar-Signature" {
+		t.Fatalf("blob was marked %q %q", blob.ScanStatus, blob.ScanSignature)
+	}
+
+	if len(fixture.mail.sent) != 1 || fixture.mail.sent[0].Template != "file-quarantined" {
+		t.Fatalf("expected the owner to be emailed once, sent %+v", fixture.mail.sent)
+	}
+
+	if _, err := fixture.getFile(); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("expected %v, got %v", ErrFileQuarantined, err)
+	}
+}
+
+func TestScanFailurePolicy(t *testing.T) {
+	defer func(policy string) { ScanFailurePolicy = policy }(ScanFailurePolicy)
+
+	tests := []struct {
+		policy string
+		err    error
+	}{
+		{policy: ScanFailureServe},
+		{policy: ScanFailureQuarantine, err: ErrFileQuarantined},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			ScanFailurePolicy = test.policy
+			fixture := newScanFixture(t, &fakeScanner{err: config.ErrScanFailed})
+
+			if err := fixture.scanService.ScanPendingContent(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if status := fixture.blobs.blobs[*fixture.file.BlobID].ScanStatus; status != ScanStatusFailed {
+				t.Fatalf("blob was marked %q", status)
+			}
+
+			got, err := fixture.getFile()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			if got.Body != nil {
+				got.Body.Close()
+			}
+		})
+	}
+}
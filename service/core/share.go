@@ -0,0 +1,417 @@
+package core_service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	"github.com/shordem/api.thryvo/repository"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+// MaxSharePasswordLength caps share link passwords, hashing is slow enough without huge inputs
+const MaxSharePasswordLength = 128
+
+// shareTokenSize is how many random bytes a share link token holds
+const shareTokenSize = 32
+
+var (
+	ErrShareNotFound         = errors.New("share link not found")
+	ErrShareExpired          = errors.New("this share link has expired")
+	ErrShareRevoked          = errors.New("this share link was revoked")
+	ErrShareDownloadLimit    = errors.New("this share link has reached its download limit")
+	ErrSharePasswordRequired = errors.New("this share link is protected by a password")
+	ErrInvalidSharePassword  = errors.New("the password for this share link is not correct")
+	ErrInvalidShareTarget    = errors.New("a share link points at either a file or a folder")
+	ErrInvalidSharePolicy    = errors.New("max_downloads must be at least 1 and passwords at most 128 characters long")
+)
+
+type ShareServiceInterface interface {
+	CreateShareLink(userId uuid.UUID, share dto.CreateShareLinkDTO) (dto.ShareLinkDTO, error)
+	FindShareLinks(userId uuid.UUID) ([]dto.ShareLinkDTO, error)
+	RevokeShareLink(id uuid.UUID, userId uuid.UUID) error
+	// ResolveShareLink returns the shared file, or the content of folderId inside a shared folder, the
+	// shared folder itself when folderId is nil
+	ResolveShareLink(token string, password string, folderId *uuid.UUID, pageable repository.Pageable) (dto.SharedContentDTO, repository.Pagination, error)
+	// GetSharedFile serves the shared file, or fileId from inside a shared folder. Every download that
+	// starts at the beginning of the file counts against the link's limit.
+	GetSharedFile(token string, password string, fileId *uuid.UUID, conditions dto.FileConditionsDTO) (dto.GetFileDTO, error)
+}
+
+type shareService struct {
+	shareRepository  core_repository.ShareLinkRepositoryInterface
+	fileRepository   core_repository.FileRepositoryInterface
+	folderRepository core_repository.FolderRepositoryInterface
+	fileService      FileServiceInterface
+	hashing          helper.HashingInterface
+}
+
+func NewShareService(
+	shareRepository core_repository.ShareLinkRepositoryInterface,
+	fileRepository core_repository.FileRepositoryInterface,
+	folderRepository core_repository.FolderRepositoryInterface,
+	fileService FileServiceInterface,
+	hashing helper.HashingInterface,
+) ShareServiceInterface {
+	return &shareService{
+		shareRepository:  shareRepository,
+		fileRepository:   fileRepository,
+		folderRepository: folderRepository,
+		fileService:      fileService,
+		hashing:          hashing,
+	}
+}
+
+func (s *shareService) ConvertToDTO(link model.ShareLink) dto.ShareLinkDTO {
+	var linkDto dto.ShareLinkDTO
+
+	linkDto.ID = link.ID
+	linkDto.Token = link.Token
+	linkDto.FileID = link.FileID
+	linkDto.FolderID = link.FolderID
+	linkDto.HasPassword = link.PasswordHash != nil
+	linkDto.ExpiresAt = link.ExpiresAt
+	linkDto.MaxDownloads = link.MaxDownloads
+	linkDto.Downloads = link.Downloads
+	linkDto.RevokedAt = link.RevokedAt
+	linkDto.CreatedAt = link.CreatedAt
+	linkDto.UpdatedAt = link.UpdatedAt
+
+	return linkDto
+}
+
+func (s *shareService) CreateShareLink(userId uuid.UUID, share dto.CreateShareLinkDTO) (dto.ShareLinkDTO, error) {
+	if (share.FileID == nil) == (share.FolderID == nil) {
+		return dto.ShareLinkDTO{}, ErrInvalidShareTarget
+	}
+
+	if (share.MaxDownloads != nil && *share.MaxDownloads < 1) || len(share.Password) > MaxSharePasswordLength {
+		return dto.ShareLinkDTO{}, ErrInvalidSharePolicy
+	}
+
+	if share.ExpiresAt != nil && !share.ExpiresAt.After(time.Now()) {
+		return dto.ShareLinkDTO{}, ErrInvalidExpiry
+	}
+
+	if share.FileID != nil {
+		if _, err := s.findOwnFile(*share.FileID, userId); err != nil {
+			return dto.ShareLinkDTO{}, err
+		}
+	} else {
+		folder, err := s.folderRepository.FindFolderById(*share.FolderID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.ShareLinkDTO{}, err
+		}
+
+		if err != nil || folder.UserID != userId {
+			return dto.ShareLinkDTO{}, ErrFolderNotFound
+		}
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return dto.ShareLinkDTO{}, err
+	}
+
+	link := model.ShareLink{
+		UserID:       userId,
+		Token:        token,
+		FileID:       share.FileID,
+		FolderID:     share.FolderID,
+		ExpiresAt:    share.ExpiresAt,
+		MaxDownloads: share.MaxDownloads,
+	}
+
+	if share.Password != "" {
+		hash, err := s.hashing.HashPassword(share.Password)
+		if err != nil {
+			return dto.ShareLinkDTO{}, err
+		}
+
+		link.PasswordHash = &hash
+	}
+
+	link, err = s.shareRepository.CreateShareLink(link)
+	if err != nil {
+		return dto.ShareLinkDTO{}, err
+	}
+
+	return s.ConvertToDTO(link), nil
+}
+
+func (s *shareService) FindShareLinks(userId uuid.UUID) ([]dto.ShareLinkDTO, error) {
+	links, err := s.shareRepository.FindShareLinksByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	linksDto := []dto.ShareLinkDTO{}
+	for _, link := range links {
+		linksDto = append(linksDto, s.ConvertToDTO(link))
+	}
+
+	return linksDto, nil
+}
+
+func (s *shareService) RevokeShareLink(id uuid.UUID, userId uuid.UUID) error {
+	link, err := s.shareRepository.FindShareLinkById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareNotFound
+		}
+
+		return err
+	}
+
+	if link.UserID != userId {
+		return ErrShareNotFound
+	}
+
+	return s.shareRepository.RevokeShareLink(link.ID)
+}
+
+func (s *shareService) ResolveShareLink(token string, password string, folderId *uuid.UUID, pageable repository.Pageable) (dto.SharedContentDTO, repository.Pagination, error) {
+	link, err := s.openShareLink(token, password)
+	if err != nil {
+		return dto.SharedContentDTO{}, repository.Pagination{}, err
+	}
+
+	content := dto.SharedContentDTO{ExpiresAt: link.ExpiresAt}
+	if link.MaxDownloads != nil {
+		left := max(*link.MaxDownloads-link.Downloads, 0)
+		content.DownloadsLeft = &left
+	}
+
+	if link.FileID != nil {
+		if folderId != nil {
+			return dto.SharedContentDTO{}, repository.Pagination{}, ErrFolderNotFound
+		}
+
+		file, err := s.findOwnFile(*link.FileID, link.UserID)
+		if err != nil {
+			return dto.SharedContentDTO{}, repository.Pagination{}, err
+		}
+
+		shared := sharedFile(file)
+		content.File = &shared
+
+		return content, repository.Pagination{CurrentPage: 1, TotalPages: 1, TotalItems: 1}, nil
+	}
+
+	if folderId == nil {
+		folderId = link.FolderID
+	}
+
+	folder, err := s.findSharedFolder(link, *folderId)
+	if err != nil {
+		return dto.SharedContentDTO{}, repository.Pagination{}, err
+	}
+
+	content.Folder = &dto.SharedFolderDTO{ID: folder.ID, Name: folder.Name}
+
+	folders, err := s.folderRepository.FindFoldersByParentId(link.UserID, folder.ID)
+	if err != nil {
+		return dto.SharedContentDTO{}, repository.Pagination{}, err
+	}
+
+	content.Folders = []dto.SharedFolderDTO{}
+	for _, child := range folders {
+		content.Folders = append(content.Folders, dto.SharedFolderDTO{ID: child.ID, Name: child.Name})
+	}
+
+	files, pagination, err := s.fileRepository.FindAllFiles(core_repository.FilePageable{
+		Pageable: pageable,
+		UserId:   link.UserID,
+		FolderId: folder.ID,
+	})
+	if err != nil {
+		return dto.SharedContentDTO{}, repository.Pagination{}, err
+	}
+
+	content.Files = []dto.SharedFileDTO{}
+	for _, file := range files {
+		content.Files = append(content.Files, sharedFile(file))
+	}
+
+	return content, pagination, nil
+}
+
+func (s *shareService) GetSharedFile(token string, password string, fileId *uuid.UUID, conditions dto.FileConditionsDTO) (dto.GetFileDTO, error) {
+	link, err := s.openShareLink(token, password)
+	if err != nil {
+		return dto.GetFileDTO{}, err
+	}
+
+	var file model.File
+
+	switch {
+	case link.FileID != nil:
+		if fileId != nil && *fileId != *link.FileID {
+			return dto.GetFileDTO{}, ErrFileNotFound
+		}
+
+		file, err = s.findOwnFile(*link.FileID, link.UserID)
+	case fileId == nil:
+		return dto.GetFileDTO{}, ErrFileNotFound
+	default:
+		file, err = s.findOwnFile(*fileId, link.UserID)
+		if err == nil && file.FolderID == nil {
+			err = ErrFileNotFound
+		}
+
+		if err == nil {
+			if _, err = s.findSharedFolder(link, *file.FolderID); errors.Is(err, ErrFolderNotFound) {
+				err = ErrFileNotFound
+			}
+		}
+	}
+
+	if err != nil {
+		return dto.GetFileDTO{}, err
+	}
+
+	// only the current version is shared
+	conditions.Version = 0
+
+	return s.fileService.GetFile(file.UserID.String(), file.Key, dto.FileAccessDTO{
+		Granted: true,
+		Serving: func(byteRange *dto.ByteRange) error {
+			return s.countDownload(link, byteRange)
+		},
+	}, conditions)
+}
+
+// countDownload counts a response that starts at the first byte of the file or its transformation
+// against the link's download limit. The requests players and resumed downloads make for the rest of
+// it aren't downloads of their own.
+func (s *shareService) countDownload(link model.ShareLink, byteRange *dto.ByteRange) error {
+	if byteRange != nil && byteRange.Start > 0 {
+		return nil
+	}
+
+	counted, err := s.shareRepository.CountDownload(link.ID)
+	if err == nil && !counted {
+		err = ErrShareDownloadLimit
+	}
+
+	return err
+}
+
+// openShareLink finds the link behind token and checks that it can still be used with password
+func (s *shareService) openShareLink(token string, password string) (model.ShareLink, error) {
+	link, err := s.shareRepository.FindShareLinkByToken(token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ShareLink{}, ErrShareNotFound
+		}
+
+		return model.ShareLink{}, err
+	}
+
+	switch {
+	case link.RevokedAt != nil:
+		return model.ShareLink{}, ErrShareRevoked
+	case link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()):
+		return model.ShareLink{}, ErrShareExpired
+	case link.MaxDownloads != nil && link.Downloads >= *link.MaxDownloads:
+		return model.ShareLink{}, ErrShareDownloadLimit
+	}
+
+	if link.PasswordHash == nil {
+		return link, nil
+	}
+
+	if password == "" {
+		return model.ShareLink{}, ErrSharePasswordRequired
+	}
+
+	match, err := s.hashing.ComparePassword(password, *link.PasswordHash)
+	if err != nil {
+		return model.ShareLink{}, err
+	}
+
+	if !match {
+		return model.ShareLink{}, ErrInvalidSharePassword
+	}
+
+	return link, nil
+}
+
+// findOwnFile returns the user's file as long as it is neither trashed nor expired
+func (s *shareService) findOwnFile(id uuid.UUID, userId uuid.UUID) (model.File, error) {
+	file, err := s.fileRepository.FindFileById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.File{}, ErrFileNotFound
+		}
+
+		return model.File{}, err
+	}
+
+	if file.UserID != userId {
+		return model.File{}, ErrFileNotFound
+	}
+
+	if file.ExpiresAt != nil && !file.ExpiresAt.After(time.Now()) {
+		return model.File{}, ErrFileExpired
+	}
+
+	return file, nil
+}
+
+// findSharedFolder returns folderId when it is the folder the link shares or below it
+func (s *shareService) findSharedFolder(link model.ShareLink, folderId uuid.UUID) (model.Folder, error) {
+	folders, err := s.folderRepository.FindFoldersByUserId(link.UserID)
+	if err != nil {
+		return model.Folder{}, err
+	}
+
+	byId := map[uuid.UUID]model.Folder{}
+	for _, folder := range folders {
+		byId[folder.ID] = folder
+	}
+
+	folder, ok := byId[folderId]
+
+	// the walk up is bounded by the number of folders in case the tree has a cycle
+	for current, steps := folder, 0; ok && steps <= len(folders); steps++ {
+		if current.ID == *link.FolderID {
+			return folder, nil
+		}
+
+		if current.ParentID == nil {
+			break
+		}
+
+		current, ok = byId[*current.ParentID]
+	}
+
+	return model.Folder{}, ErrFolderNotFound
+}
+
+func sharedFile(file model.File) dto.SharedFileDTO {
+	return dto.SharedFileDTO{
+		ID:        file.ID,
+		Name:      file.OriginalName,
+		MimeType:  file.MimeType,
+		Size:      file.Size,
+		UpdatedAt: file.UpdatedAt,
+	}
+}
+
+// newShareToken returns a random URL safe token, it is the only thing needed to open a link without a password
+func newShareToken() (string, error) {
+	token := make([]byte, shareTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
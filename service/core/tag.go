@@ -0,0 +1,253 @@
+package core_service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+// MaxTagNameLength caps the length of tag names in characters
+const MaxTagNameLength = 64
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTagExists       = errors.New("a tag with this name already exists")
+	ErrInvalidTagName  = errors.New("tag names must be 1 to 64 characters long and can't contain commas")
+	ErrInvalidTagColor = errors.New("tag colors must look like #1a2b3c")
+	ErrNoTagsSelected  = errors.New("no tags selected")
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagServiceInterface interface {
+	CreateTag(tagDto dto.TagDTO) (dto.TagDTO, error)
+	FindTags(userId uuid.UUID) ([]dto.TagDTO, error)
+	UpdateTag(id uuid.UUID, userId uuid.UUID, name *string, color *string) (dto.TagDTO, error)
+	DeleteTag(id uuid.UUID, userId uuid.UUID) error
+	TagItems(userId uuid.UUID, items dto.TagItemsDTO) error
+	UntagItems(userId uuid.UUID, items dto.TagItemsDTO) error
+}
+
+type tagService struct {
+	tagRepository    core_repository.TagRepositoryInterface
+	fileRepository   core_repository.FileRepositoryInterface
+	folderRepository core_repository.FolderRepositoryInterface
+}
+
+func NewTagService(
+	tagRepository core_repository.TagRepositoryInterface,
+	fileRepository core_repository.FileRepositoryInterface,
+	folderRepository core_repository.FolderRepositoryInterface,
+) TagServiceInterface {
+	return &tagService{
+		tagRepository:    tagRepository,
+		fileRepository:   fileRepository,
+		folderRepository: folderRepository,
+	}
+}
+
+func (s *tagService) ConvertToDTO(tag model.Tag) dto.TagDTO {
+	return convertTag(tag)
+}
+
+func convertTag(tag model.Tag) dto.TagDTO {
+	var tagDto dto.TagDTO
+
+	tagDto.ID = tag.ID
+	tagDto.UserID = tag.UserID
+	tagDto.Name = tag.Name
+	tagDto.Color = tag.Color
+	tagDto.CreatedAt = tag.CreatedAt
+	tagDto.UpdatedAt = tag.UpdatedAt
+
+	return tagDto
+}
+
+func (s *tagService) CreateTag(tagDto dto.TagDTO) (dto.TagDTO, error) {
+	tag := model.Tag{UserID: tagDto.UserID, Name: strings.TrimSpace(tagDto.Name), Color: strings.ToLower(tagDto.Color)}
+
+	if err := s.validate(tag); err != nil {
+		return dto.TagDTO{}, err
+	}
+
+	tag, err := s.tagRepository.CreateTag(tag)
+	if err != nil {
+		return dto.TagDTO{}, err
+	}
+
+	return s.ConvertToDTO(tag), nil
+}
+
+func (s *tagService) FindTags(userId uuid.UUID) ([]dto.TagDTO, error) {
+	tags, err := s.tagRepository.FindTagsByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertTags(tags), nil
+}
+
+// UpdateTag renames and/or recolors a tag, nil values are left unchanged
+func (s *tagService) UpdateTag(id uuid.UUID, userId uuid.UUID, name *string, color *string) (dto.TagDTO, error) {
+	tag, err := s.findTag(id, userId)
+	if err != nil {
+		return dto.TagDTO{}, err
+	}
+
+	if name != nil {
+		tag.Name = strings.TrimSpace(*name)
+	}
+
+	if color != nil {
+		tag.Color = strings.ToLower(*color)
+	}
+
+	if err := s.validate(tag); err != nil {
+		return dto.TagDTO{}, err
+	}
+
+	tag, err = s.tagRepository.UpdateTag(tag)
+	if err != nil {
+		return dto.TagDTO{}, err
+	}
+
+	return s.ConvertToDTO(tag), nil
+}
+
+func (s *tagService) DeleteTag(id uuid.UUID, userId uuid.UUID) error {
+	tag, err := s.findTag(id, userId)
+	if err != nil {
+		return err
+	}
+
+	return s.tagRepository.DeleteTag(tag.ID)
+}
+
+// TagItems attaches every selected tag to every selected file and folder
+func (s *tagService) TagItems(userId uuid.UUID, items dto.TagItemsDTO) error {
+	items, err := s.checkItems(userId, items)
+	if err != nil {
+		return err
+	}
+
+	return s.tagRepository.AttachTags(items.TagIDs, items.FileIDs, items.FolderIDs)
+}
+
+// UntagItems detaches every selected tag from every selected file and folder
+func (s *tagService) UntagItems(userId uuid.UUID, items dto.TagItemsDTO) error {
+	items, err := s.checkItems(userId, items)
+	if err != nil {
+		return err
+	}
+
+	return s.tagRepository.DetachTags(items.TagIDs, items.FileIDs, items.FolderIDs)
+}
+
+// checkItems deduplicates the selection and makes sure every tag, file and folder in it belongs to the user
+func (s *tagService) checkItems(userId uuid.UUID, items dto.TagItemsDTO) (dto.TagItemsDTO, error) {
+	items.TagIDs = uniqueIds(items.TagIDs)
+	items.FileIDs = uniqueIds(items.FileIDs)
+	items.FolderIDs = uniqueIds(items.FolderIDs)
+
+	if len(items.TagIDs) == 0 {
+		return items, ErrNoTagsSelected
+	}
+
+	if len(items.FileIDs) == 0 && len(items.FolderIDs) == 0 {
+		return items, ErrNoFilesSelected
+	}
+
+	if len(items.TagIDs)*(len(items.FileIDs)+len(items.FolderIDs)) > MaxBulkFiles {
+		return items, ErrTooManyFiles
+	}
+
+	tags, err := s.tagRepository.FindTagsByIds(userId, items.TagIDs)
+	if err != nil {
+		return items, err
+	}
+
+	if len(tags) != len(items.TagIDs) {
+		return items, ErrTagNotFound
+	}
+
+	if len(items.FileIDs) > 0 {
+		files, err := s.fileRepository.FindFilesByIds(userId, items.FileIDs)
+		if err != nil {
+			return items, err
+		}
+
+		if len(files) != len(items.FileIDs) {
+			return items, ErrFileNotFound
+		}
+	}
+
+	if len(items.FolderIDs) > 0 {
+		folders, err := s.folderRepository.FindFoldersByIds(userId, items.FolderIDs)
+		if err != nil {
+			return items, err
+		}
+
+		if len(folders) != len(items.FolderIDs) {
+			return items, ErrFolderNotFound
+		}
+	}
+
+	return items, nil
+}
+
+// validate checks the name and color of a tag and that no other tag of the user has its name
+func (s *tagService) validate(tag model.Tag) error {
+	if tag.Name == "" || utf8.RuneCountInString(tag.Name) > MaxTagNameLength || strings.Contains(tag.Name, ",") {
+		return ErrInvalidTagName
+	}
+
+	if tag.Color != "" && !tagColorPattern.MatchString(tag.Color) {
+		return ErrInvalidTagColor
+	}
+
+	existing, err := s.tagRepository.FindTagByName(tag.UserID, tag.Name)
+	if err == nil && existing.ID != tag.ID {
+		return ErrTagExists
+	}
+
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func (s *tagService) findTag(id uuid.UUID, userId uuid.UUID) (model.Tag, error) {
+	tag, err := s.tagRepository.FindTagById(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return model.Tag{}, ErrTagNotFound
+		}
+
+		return model.Tag{}, err
+	}
+
+	if tag.UserID != userId {
+		return model.Tag{}, ErrTagNotFound
+	}
+
+	return tag, nil
+}
+
+// convertTags converts the tags of a file or folder, or a user's tags
+func convertTags(tags []model.Tag) []dto.TagDTO {
+	tagsDto := []dto.TagDTO{}
+	for _, tag := range tags {
+		tagsDto = append(tagsDto, convertTag(tag))
+	}
+
+	return tagsDto
+}
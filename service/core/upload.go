@@ -0,0 +1,371 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/config"
+	"github.com/shordem/api.thryvo/lib/helper"
+	"github.com/shordem/api.thryvo/model"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadExpired        = errors.New("upload has expired")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match the current offset")
+)
+
+// UploadSessionLifetime is how long an unfinished resumable upload is kept
+var UploadSessionLifetime = 24 * time.Hour
+
+type UploadServiceInterface interface {
+	CreateUpload(uploadDto dto.UploadSessionDTO) (dto.UploadSessionDTO, error)
+	GetUpload(id uuid.UUID, userId uuid.UUID) (dto.UploadSessionDTO, error)
+	AppendChunk(id uuid.UUID, userId uuid.UUID, offset int64, body io.Reader) (dto.UploadSessionDTO, error)
+	TerminateUpload(id uuid.UUID, userId uuid.UUID) error
+	CleanupExpiredUploads(ctx context.Context) error
+}
+
+type uploadService struct {
+	fileConfig       config.FileConfigInterface
+	uploadRepository core_repository.UploadRepositoryInterface
+	folderRepository core_repository.FolderRepositoryInterface
+	fileService      FileServiceInterface
+	usage            StorageUsageServiceInterface
+	planLimits       PlanLimitChecker
+	permissions      PermissionServiceInterface
+}
+
+func NewUploadService(
+	fileConfig config.FileConfigInterface,
+	uploadRepository core_repository.UploadRepositoryInterface,
+	folderRepository core_repository.FolderRepositoryInterface,
+	fileService FileServiceInterface,
+	usage StorageUsageServiceInterface,
+	planLimits PlanLimitChecker,
+	permissions PermissionServiceInterface,
+) UploadServiceInterface {
+	return &uploadService{
+		fileConfig:       fileConfig,
+		uploadRepository: uploadRepository,
+		folderRepository: folderRepository,
+		fileService:      fileService,
+		usage:            usage,
+		planLimits:       planLimits,
+		permissions:      permissions,
+	}
+}
+
+func (u *uploadService) ConvertToDTO(session model.UploadSession) dto.UploadSessionDTO {
+	var uploadDto dto.UploadSessionDTO
+
+	uploadDto.ID = session.ID
+	uploadDto.UserID = session.UserID
+	uploadDto.FolderID = session.FolderID
+	uploadDto.OriginalName = session.OriginalName
+	uploadDto.MimeType = session.MimeType
+	uploadDto.Visibility = session.Visibility
+	uploadDto.Length = session.UploadLength
+	uploadDto.Offset = session.UploadOffset
+	uploadDto.ExpiresAt = session.ExpiresAt
+	uploadDto.CreatedAt = session.CreatedAt
+	uploadDto.UpdatedAt = session.UpdatedAt
+	if session.FileID != nil {
+		uploadDto.File = &dto.FileDTO{}
+		uploadDto.File.ID = *session.FileID
+	}
+
+	return uploadDto
+}
+
+func (u *uploadService) CreateUpload(uploadDto dto.UploadSessionDTO) (dto.UploadSessionDTO, error) {
+	limits, err := u.planLimits.GetPlanLimits(context.Background(), uploadDto.UserID)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	visibility, err := ParseVisibility(uploadDto.Visibility)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	if uploadDto.Length > limits.MaxUploadSize {
+		return dto.UploadSessionDTO{}, helper.ErrBodyTooLarge
+	}
+
+	// the folder is checked again when the upload completes, this only saves sending bytes that can't be kept.
+	// Files uploaded to a folder shared with the uploader belong to, and count against, the folder's owner.
+	ownerId := uploadDto.UserID
+	if uploadDto.FolderID != nil {
+		folder, err := findFolder(u.folderRepository, u.permissions, *uploadDto.FolderID, uploadDto.UserID, PermissionRoleEditor)
+		if err != nil {
+			return dto.UploadSessionDTO{}, err
+		}
+
+		ownerId = folder.UserID
+	}
+
+	if err := u.usage.CheckQuota(ownerId, uploadDto.Length); err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	session, err := u.uploadRepository.CreateSession(model.UploadSession{
+		UserID:       uploadDto.UserID,
+		FolderID:     uploadDto.FolderID,
+		OriginalName: uploadDto.OriginalName,
+		MimeType:     uploadDto.MimeType,
+		Visibility:   visibility,
+		UploadLength: uploadDto.Length,
+		ExpiresAt:    time.Now().Add(UploadSessionLifetime),
+	})
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	// an empty upload has nothing left to send
+	if session.UploadLength == 0 {
+		return u.complete(session)
+	}
+
+	return u.ConvertToDTO(session), nil
+}
+
+func (u *uploadService) findSession(id uuid.UUID, userId uuid.UUID) (model.UploadSession, error) {
+	session, err := u.uploadRepository.FindSessionById(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return model.UploadSession{}, ErrUploadNotFound
+		}
+
+		return model.UploadSession{}, err
+	}
+
+	if session.UserID != userId {
+		return model.UploadSession{}, ErrUploadNotFound
+	}
+
+	return session, nil
+}
+
+func (u *uploadService) GetUpload(id uuid.UUID, userId uuid.UUID) (dto.UploadSessionDTO, error) {
+	session, err := u.findSession(id, userId)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	if session.FileID == nil && time.Now().After(session.ExpiresAt) {
+		return dto.UploadSessionDTO{}, ErrUploadExpired
+	}
+
+	return u.ConvertToDTO(session), nil
+}
+
+// AppendChunk stores body as the next chunk of the upload, assembling the file once all bytes are in.
+// When the body breaks off, the bytes received so far are kept as a chunk so the client can resume after them.
+func (u *uploadService) AppendChunk(id uuid.UUID, userId uuid.UUID, offset int64, body io.Reader) (dto.UploadSessionDTO, error) {
+	session, err := u.findSession(id, userId)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	if session.FileID != nil {
+		if offset != session.UploadLength {
+			return dto.UploadSessionDTO{}, ErrUploadOffsetMismatch
+		}
+
+		return u.ConvertToDTO(session), nil
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return dto.UploadSessionDTO{}, ErrUploadExpired
+	}
+
+	if offset != session.UploadOffset {
+		return dto.UploadSessionDTO{}, ErrUploadOffsetMismatch
+	}
+
+	if remaining := session.UploadLength - session.UploadOffset; remaining > 0 {
+		chunkId, err := helper.GenerateSnowflakeID()
+		if err != nil {
+			return dto.UploadSessionDTO{}, err
+		}
+
+		path := fmt.Sprintf("%s/uploads/%s/%d-%d", session.UserID, session.ID, offset, chunkId)
+		received := &helper.TruncatingReader{Reader: body}
+		counter := &helper.CountingReader{Reader: helper.NewLimitedReader(received, remaining)}
+
+		if err := u.fileConfig.PutObject(path, counter, -1, "application/octet-stream"); err != nil {
+			u.fileConfig.DeleteObject(path)
+			return dto.UploadSessionDTO{}, err
+		}
+
+		if counter.Count == 0 {
+			u.fileConfig.DeleteObject(path)
+
+			if received.Err != nil {
+				return dto.UploadSessionDTO{}, received.Err
+			}
+
+			return u.ConvertToDTO(session), nil
+		}
+
+		appended, err := u.uploadRepository.AppendChunk(model.UploadChunk{
+			UploadSessionID: session.ID,
+			StartOffset:     offset,
+			Size:            counter.Count,
+			Path:            path,
+		})
+		if err != nil || !appended {
+			u.fileConfig.DeleteObject(path)
+
+			if err != nil {
+				return dto.UploadSessionDTO{}, err
+			}
+
+			return dto.UploadSessionDTO{}, ErrUploadOffsetMismatch
+		}
+
+		session.UploadOffset += counter.Count
+
+		if received.Err != nil {
+			return dto.UploadSessionDTO{}, received.Err
+		}
+	}
+
+	if session.UploadOffset < session.UploadLength {
+		return u.ConvertToDTO(session), nil
+	}
+
+	return u.complete(session)
+}
+
+// complete assembles the chunks of a finished upload into a file
+func (u *uploadService) complete(session model.UploadSession) (dto.UploadSessionDTO, error) {
+	chunks, err := u.uploadRepository.FindChunksBySessionId(session.ID)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	reader := &chunkReader{fileConfig: u.fileConfig, chunks: chunks}
+	defer reader.Close()
+
+	uploaded, err := u.fileService.UploadFile(dto.FileDTO{
+		UserID:       session.UserID,
+		FolderID:     session.FolderID,
+		OriginalName: session.OriginalName,
+		MimeType:     session.MimeType,
+		Visibility:   session.Visibility,
+	}, reader)
+	if err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	if err := u.uploadRepository.CompleteSession(session.ID, uploaded.Info.ID); err != nil {
+		return dto.UploadSessionDTO{}, err
+	}
+
+	u.removeChunks(chunks)
+	u.uploadRepository.DeleteChunksBySessionId(session.ID)
+
+	session.FileID = &uploaded.Info.ID
+	uploadDto := u.ConvertToDTO(session)
+	uploadDto.File = &uploaded.Info
+
+	return uploadDto, nil
+}
+
+func (u *uploadService) TerminateUpload(id uuid.UUID, userId uuid.UUID) error {
+	session, err := u.findSession(id, userId)
+	if err != nil {
+		return err
+	}
+
+	return u.removeSession(session)
+}
+
+func (u *uploadService) CleanupExpiredUploads(ctx context.Context) error {
+	sessions, err := u.uploadRepository.FindExpiredSessions(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := u.removeSession(session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *uploadService) removeSession(session model.UploadSession) error {
+	chunks, err := u.uploadRepository.FindChunksBySessionId(session.ID)
+	if err != nil {
+		return err
+	}
+
+	u.removeChunks(chunks)
+
+	return u.uploadRepository.DeleteSession(session.ID)
+}
+
+func (u *uploadService) removeChunks(chunks []model.UploadChunk) {
+	for _, chunk := range chunks {
+		u.fileConfig.DeleteObject(chunk.Path)
+	}
+}
+
+// chunkReader reads the chunks of an upload one after the other, opening each one lazily
+type chunkReader struct {
+	fileConfig config.FileConfigInterface
+	chunks     []model.UploadChunk
+	current    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			obj, err := r.fileConfig.GetObject(r.chunks[0].Path, nil)
+			if err != nil {
+				return 0, err
+			}
+
+			r.current = obj.Body
+			r.chunks = r.chunks[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+
+			if n == 0 {
+				continue
+			}
+
+			return n, nil
+		}
+
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	return r.current.Close()
+}
@@ -0,0 +1,86 @@
+package core_service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/shordem/api.thryvo/dto"
+	core_repository "github.com/shordem/api.thryvo/repository/core"
+)
+
+var ErrStorageQuotaExceeded = errors.New("this upload would exceed the storage quota of your plan")
+
+// StorageUsageServiceInterface reports how much of their plan's storage quota users have used.
+// Usage counts stored content once, files sharing content through deduplication or versions don't add to it.
+type StorageUsageServiceInterface interface {
+	GetUsage(userId uuid.UUID) (dto.StorageUsageDTO, error)
+	RemainingStorage(userId uuid.UUID) (int64, error)
+	CheckQuota(userId uuid.UUID, size int64) error
+}
+
+type storageUsageService struct {
+	usageRepository core_repository.StorageUsageRepositoryInterface
+	planLimits      PlanLimitChecker
+}
+
+func NewStorageUsageService(usageRepository core_repository.StorageUsageRepositoryInterface, planLimits PlanLimitChecker) StorageUsageServiceInterface {
+	return &storageUsageService{usageRepository: usageRepository, planLimits: planLimits}
+}
+
+func (s *storageUsageService) GetUsage(userId uuid.UUID) (dto.StorageUsageDTO, error) {
+	usage, err := s.usage(userId)
+	if err != nil {
+		return dto.StorageUsageDTO{}, err
+	}
+
+	usage.FileCount, err = s.usageRepository.CountFiles(userId)
+	if err != nil {
+		return dto.StorageUsageDTO{}, err
+	}
+
+	return usage, nil
+}
+
+// RemainingStorage is how many more bytes the user can store, 0 once the quota is used up
+func (s *storageUsageService) RemainingStorage(userId uuid.UUID) (int64, error) {
+	usage, err := s.usage(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return usage.BytesRemaining, nil
+}
+
+// CheckQuota fails with ErrStorageQuotaExceeded when size more bytes don't fit in the user's quota
+func (s *storageUsageService) CheckQuota(userId uuid.UUID, size int64) error {
+	remaining, err := s.RemainingStorage(userId)
+	if err != nil {
+		return err
+	}
+
+	if size > remaining {
+		return ErrStorageQuotaExceeded
+	}
+
+	return nil
+}
+
+func (s *storageUsageService) usage(userId uuid.UUID) (dto.StorageUsageDTO, error) {
+	limits, err := s.planLimits.GetPlanLimits(context.Background(), userId)
+	if err != nil {
+		return dto.StorageUsageDTO{}, err
+	}
+
+	usage, err := s.usageRepository.FindUsageByUserId(userId)
+	if err != nil {
+		return dto.StorageUsageDTO{}, err
+	}
+
+	return dto.StorageUsageDTO{
+		BytesUsed:      usage.BytesUsed,
+		StorageQuota:   limits.StorageQuota,
+		BytesRemaining: max(limits.StorageQuota-usage.BytesUsed, 0),
+	}, nil
+}
@@ -10,6 +10,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/shordem/api.thryvo/dto"
+	"github.com/shordem/api.thryvo/lib/constants"
 	"github.com/shordem/api.thryvo/model"
 	"github.com/shordem/api.thryvo/payload/request"
 	"github.com/shordem/api.thryvo/payload/response"
@@ -39,6 +40,9 @@ type SubscriptionServiceInterface interface {
 	// Transactions
 	GetUserTransactions(ctx context.Context, userID uuid.UUID) ([]response.Transaction, error)
 
+	// Limits
+	GetPlanLimits(ctx context.Context, userID uuid.UUID) (*dto.PlanLimits, error)
+
 	// Maintenance
 	CheckAndExpireSubscriptions(ctx context.Context) error
 }
@@ -66,14 +70,7 @@ func (s *subscriptionService) GetAllPlans(ctx context.Context) ([]response.Subsc
 
 	result := make([]response.SubscriptionPlan, len(plans))
 	for i, plan := range plans {
-		result[i] = response.SubscriptionPlan{
-			ID:          plan.ID.String(),
-			Name:        plan.Name,
-			Description: plan.Description,
-			Price:       plan.Price,
-			Currency:    plan.Currency,
-			Duration:    plan.Duration,
-		}
+		result[i] = s.toPlanResponse(&plan)
 	}
 
 	return result, nil
@@ -87,6 +84,11 @@ func (s *subscriptionService) CreatePlan(ctx context.Context, req *request.Creat
 		Currency:    req.Currency,
 		Duration:    req.Duration,
 		IsActive:    true,
+
+		MaxUploadSize:   req.MaxUploadSize,
+		MaxFileVersions: req.MaxFileVersions,
+		StorageQuota:    req.StorageQuota,
+		MaxArchiveSize:  req.MaxArchiveSize,
 	}
 
 	if err := s.repository.CreatePlan(ctx, plan); err != nil {
@@ -100,6 +102,11 @@ func (s *subscriptionService) CreatePlan(ctx context.Context, req *request.Creat
 		Price:       plan.Price,
 		Currency:    plan.Currency,
 		Duration:    plan.Duration,
+
+		MaxUploadSize:   plan.MaxUploadSize,
+		MaxFileVersions: plan.MaxFileVersions,
+		StorageQuota:    plan.StorageQuota,
+		MaxArchiveSize:  plan.MaxArchiveSize,
 	}, nil
 }
 
@@ -128,6 +135,18 @@ func (s *subscriptionService) UpdatePlan(ctx context.Context, id uuid.UUID, req
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.MaxUploadSize != nil {
+		updates["max_upload_size"] = *req.MaxUploadSize
+	}
+	if req.MaxFileVersions != nil {
+		updates["max_file_versions"] = *req.MaxFileVersions
+	}
+	if req.StorageQuota != nil {
+		updates["storage_quota"] = *req.StorageQuota
+	}
+	if req.MaxArchiveSize != nil {
+		updates["max_archive_size"] = *req.MaxArchiveSize
+	}
 
 	if err := s.repository.UpdatePlan(ctx, id, updates); err != nil {
 		return nil, err
@@ -137,24 +156,12 @@ func (s *subscriptionService) UpdatePlan(ctx context.Context, id uuid.UUID, req
 	updated, err := s.repository.GetPlanByID(ctx, id)
 	if err != nil {
 		// Return with updated values if fetch fails
-		return &response.SubscriptionPlan{
-			ID:          existing.ID.String(),
-			Name:        existing.Name,
-			Description: existing.Description,
-			Price:       existing.Price,
-			Currency:    existing.Currency,
-			Duration:    existing.Duration,
-		}, nil
+		result := s.toPlanResponse(existing)
+		return &result, nil
 	}
 
-	return &response.SubscriptionPlan{
-		ID:          updated.ID.String(),
-		Name:        updated.Name,
-		Description: updated.Description,
-		Price:       updated.Price,
-		Currency:    updated.Currency,
-		Duration:    updated.Duration,
-	}, nil
+	result := s.toPlanResponse(updated)
+	return &result, nil
 }
 
 func (s *subscriptionService) DeletePlan(ctx context.Context, id uuid.UUID) error {
@@ -463,10 +470,68 @@ func (s *subscriptionService) HandleWebhook(ctx context.Context, gatewayName str
 	return nil
 }
 
+// GetPlanLimits resolves the limits of the user's active plan, falling back to the free tier
+func (s *subscriptionService) GetPlanLimits(ctx context.Context, userID uuid.UUID) (*dto.PlanLimits, error) {
+	limits := &dto.PlanLimits{
+		MaxUploadSize:   constants.FreeTierMaxUploadSize,
+		MaxFileVersions: constants.FreeTierMaxFileVersions,
+		StorageQuota:    constants.FreeTierStorageQuota,
+		MaxArchiveSize:  constants.FreeTierMaxArchiveSize,
+	}
+
+	subscription, err := s.repository.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return limits, nil
+		}
+		return nil, err
+	}
+
+	plan, err := s.repository.GetPlanByID(ctx, subscription.PlanID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return limits, nil
+		}
+		return nil, err
+	}
+
+	limits.PlanID = &plan.ID
+	if plan.MaxUploadSize > 0 {
+		limits.MaxUploadSize = plan.MaxUploadSize
+	}
+	if plan.MaxFileVersions > 0 {
+		limits.MaxFileVersions = plan.MaxFileVersions
+	}
+	if plan.StorageQuota > 0 {
+		limits.StorageQuota = plan.StorageQuota
+	}
+	if plan.MaxArchiveSize > 0 {
+		limits.MaxArchiveSize = plan.MaxArchiveSize
+	}
+
+	return limits, nil
+}
+
 func (s *subscriptionService) CheckAndExpireSubscriptions(ctx context.Context) error {
 	return s.repository.ExpireOldSubscriptions(ctx)
 }
 
+func (s *subscriptionService) toPlanResponse(plan *dto.SubscriptionPlan) response.SubscriptionPlan {
+	return response.SubscriptionPlan{
+		ID:          plan.ID.String(),
+		Name:        plan.Name,
+		Description: plan.Description,
+		Price:       plan.Price,
+		Currency:    plan.Currency,
+		Duration:    plan.Duration,
+
+		MaxUploadSize:   plan.MaxUploadSize,
+		MaxFileVersions: plan.MaxFileVersions,
+		StorageQuota:    plan.StorageQuota,
+		MaxArchiveSize:  plan.MaxArchiveSize,
+	}
+}
+
 func (s *subscriptionService) toSubscriptionResponse(sub *dto.UserSubscription, plan *dto.SubscriptionPlan) *response.UserSubscription {
 	now := time.Now()
 	daysRemaining := int(sub.EndDate.Sub(now).Hours() / 24)
@@ -475,15 +540,8 @@ func (s *subscriptionService) toSubscriptionResponse(sub *dto.UserSubscription,
 	}
 
 	return &response.UserSubscription{
-		ID: sub.ID.String(),
-		Plan: response.SubscriptionPlan{
-			ID:          plan.ID.String(),
-			Name:        plan.Name,
-			Description: plan.Description,
-			Price:       plan.Price,
-			Currency:    plan.Currency,
-			Duration:    plan.Duration,
-		},
+		ID:            sub.ID.String(),
+		Plan:          s.toPlanResponse(plan),
 		Status:        sub.Status,
 		StartDate:     sub.StartDate.Unix(),
 		EndDate:       sub.EndDate.Unix(),